@@ -28,7 +28,7 @@ import (
 func TestMain(m *testing.M) {
 	parseFlags()
 
-	status := godog.RunWithOptions("minishift", func(s *godog.Suite) {
+	status := testsuite.RunWithOptions("minishift", func(s *godog.Suite) {
 		getFeatureContext(s)
 	}, godog.Options{
 		Format:              testsuite.GodogFormat,
@@ -48,6 +48,13 @@ func getFeatureContext(s *godog.Suite) {
 
 	// here you can load additional step definitions, for example:
 	// mypackage.FeatureContext(s)
+	// steps registered with testsuite.Step instead of s.Step can also be
+	// used by the steps running other steps, like the retrying ones:
+	// testsuite.Step(s, `^my step$`, mypackage.MyStep)
+
+	// exit codes can be given names to be used in steps, alternatively
+	// they can be loaded from a file given by -test-exit-codes
+	testsuite.RegisterExitCode("CommandNotFound", 127)
 }
 
 func parseFlags() {
@@ -9,7 +9,7 @@ Quentin check whether their testsuite works properly.
      Go is a tool for managing Go source code.
      """
 
-  @linux @darwin
+  @linux @darwin @shell:bash @shell:zsh
   Scenario: Command which is not present
     When executing "foobar" fails
     Then exitcode should not equal "0"
@@ -18,6 +18,15 @@ Quentin check whether their testsuite works properly.
      command not found
      """
 
+  @linux @darwin @shell:sh @shell:dash @shell:ksh
+  Scenario: Command which is not present
+    When executing "foobar" fails
+    Then exitcode should equal "127"
+    Then stderr should contain
+     """
+     not found
+     """
+
   @windows
   Scenario: Command which is not present
     When executing "foobar" succeed
@@ -61,6 +70,488 @@ Quentin check whether their testsuite works properly.
      When executing "go version" succeeds
      Then stdout should not be empty
 
+  @linux @darwin
+  Scenario: Output without trailing newline
+     When executing "printf foo" succeeds
+     Then stdout should equal "foo"
+      And stderr should be empty
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Output on stdout and stderr
+     When executing "printf 'out\n'; printf err 1>&2; exit_code_of_missing_command 2>/dev/null" fails
+     Then stdout should equal "out"
+      And stderr should equal "err"
+      And exitcode should equal "127"
+
+  @linux @darwin
+  Scenario: Output line longer than 64KB
+     When executing "head -c 100000 /dev/zero | tr '\0' a" succeeds
+     Then stdout should match "^a+$"
+     When executing "echo next" succeeds
+     Then stdout should equal "next"
+
+  @linux @darwin
+  Scenario: Output which is not valid UTF-8
+     When executing "printf '\377\376binary'" succeeds
+     Then stdout should contain "binary"
+
+  @linux @darwin
+  Scenario: Command executed in a terminal
+     When executing "test -t 1 && stty size" in a terminal
+     Then exitcode should equal "0"
+      And stdout should equal "24 80"
+     When executing "test -t 1 || echo no terminal" succeeds
+     Then stdout should equal "no terminal"
+
+  @linux @darwin
+  Scenario: Command opening the controlling terminal
+     When executing "echo written to tty > /dev/tty" in a terminal
+     Then exitcode should equal "0"
+      And stdout should contain "written to tty"
+
+  @linux @darwin
+  Scenario: Command opening the controlling terminal outside a terminal
+     When executing "read x < /dev/tty" with timeout "3s"
+     Then exitcode should not equal "0"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Interactive command
+     When executing "printf 'Name: '; read name; stty -echo; printf 'Password: '; read pass; stty echo; echo; echo \"$name:$pass\"" interactively
+      And when stdout shows "Name:" send "user"
+      And when stdout shows "Password:" send secret "secret"
+     Then the interactive command exits with code 0
+      And stdout should contain "user:secret"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Interactive command failing after reading a secret
+     When executing "read token; echo token=$token; exit 3" interactively
+      And when stdout shows "" send secret "hunter2"
+     Then the following steps fail with error matching "(?s)exited with exit code 3, expected 0\nCommand output: .*token=\*{8}$":
+      """
+      the interactive command exits with code 0
+      """
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Interactive command left running
+     When executing "read first; read second" interactively
+     Then when stdout shows "" send secret "left running"
+
+  @linux @darwin
+  Scenario: Shell usable after an interactive command was left running
+     When executing "echo hi" succeeds
+     Then stdout should equal "hi"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Background process stopped by signal
+    Given starting "trap 'echo stopping; exit 0' TERM; echo ready; while true; do sleep 0.1; done" in background as "server"
+     Then background "server" stdout should contain "ready" within "10s"
+     When executing "echo still usable" succeeds
+     Then stdout should contain "still usable"
+     When sending signal "SIGTERM" to "server"
+     Then background "server" exits with code 0
+      And background "server" stdout should contain "stopping" within "1s"
+
+  @linux @darwin
+  Scenario: Background process killed by signal
+    Given starting "echo ready; sleep 60" in background as "sleeper"
+     Then background "sleeper" stdout should contain "ready" within "10s"
+     When sending signal "SIGKILL" to "sleeper"
+     Then background "sleeper" exits with code 137
+
+  @linux
+  Scenario: Background process leaving its output open
+    Given starting "setsid sleep 8 & echo started" in background as "holder"
+     Then background "holder" stdout should contain "started" within "5s"
+      And background "holder" exits with code 0
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Multiple shell sessions
+    Given executing "SESSION=host" succeeds
+      And in shell "admin" executing "SESSION=admin" succeeds
+     When in shell "admin" executing "echo $SESSION"
+     Then stdout of shell "admin" should equal "admin"
+      And stderr of shell "admin" should be empty
+     When executing "echo $SESSION"
+     Then stdout should equal "host"
+     When in shell "other" executing "echo ${SESSION:-unset}"
+     Then stdout of shell "other" should contain "unset"
+      And stdout of shell "admin" should not contain "unset"
+
+  @linux @darwin
+  Scenario: Command run without the shell
+     When running "printf" with arguments:
+       | %s;%s;                 |
+       | it's "quoted" $HOME \| |
+       | *                      |
+     Then exitcode should equal "0"
+      And stdout should equal "it's "quoted" $HOME |;*;"
+      And stderr should be empty
+     When running "false"
+     Then exitcode should equal "1"
+
+  @linux @darwin
+  Scenario: Program which is not present run without the shell
+     When running "clicumber-missing-program"
+     Then exitcode should equal "127"
+      And stderr should contain "clicumber-missing-program: command not found"
+
+  @linux @darwin
+  Scenario: Command reading stdin
+     When executing "tr a-z A-Z" with stdin:
+      """
+      first line
+      it's "quoted" $HOME
+      """
+     Then stdout should equal
+      """
+      FIRST LINE
+      IT'S "QUOTED" $HOME
+      """
+     When executing "wc -l" with the previous stdout as stdin
+     Then stdout should contain "2"
+     When creating file "stdin.txt" succeeds
+      And writing text "from file" to file "stdin.txt" succeeds
+      And executing "cat" with stdin from file "stdin.txt"
+     Then stdout should equal "from file"
+     When creating file "it's stdin.txt" succeeds
+      And writing text "from quoted file" to file "it's stdin.txt" succeeds
+      And executing "cat" with stdin from file "it's stdin.txt"
+     Then stdout should equal "from quoted file"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Script
+     When executing script succeeds:
+      """
+      SCRIPT_VAR=first
+      echo $SCRIPT_VAR
+
+      echo second 1>&2
+      """
+     Then stdout should equal "first"
+      And stderr should equal "second"
+      And exitcode should equal "0"
+     When executing script:
+      """
+      echo before
+      (exit 3)
+      """
+     Then exitcode should equal "3"
+      And stdout should equal "before"
+     When executing "HOST_VAR=host" succeeds
+      And executing script succeeds:
+      """
+      for i in 1 2; do
+        echo "line $i"
+      done
+      if [ -n "$HOST_VAR" ]; then
+        echo "host variable seen"
+      fi
+      cat <<EOF
+      heredoc \
+      continued
+      EOF
+      """
+     Then stdout should equal
+      """
+      line 1
+      line 2
+      host variable seen
+      heredoc continued
+      """
+     When executing "echo ${SCRIPT_VAR:-not kept}" succeeds
+     Then stdout should equal "not kept"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Script changing the state of the shell
+     When executing script:
+      """
+      set -e
+      false
+      echo not reached
+      """
+     Then exitcode should not equal "0"
+      And stdout should be empty
+     When executing "false" fails
+      And executing script:
+      """
+      echo exiting
+      exit 3
+      """
+     Then exitcode should equal "3"
+      And stdout should equal "exiting"
+     When executing "echo alive" succeeds
+     Then stdout should equal "alive"
+
+  @linux @darwin @shell:bash @shell:zsh
+  Scenario: Line at which a script failed
+     When executing script:
+      """
+      echo first
+      false
+      echo third
+      test -d /nonexistent
+      """
+     Then the following steps fail with "Script failed at line 4 'test -d /nonexistent'":
+      """
+      exitcode should equal "0"
+      """
+      And the following steps fail with "script failed at line 4":
+      """
+      executing script succeeds:
+        ```
+        echo first
+        false
+        echo third
+        test -d /nonexistent
+        ```
+      """
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Restarting the shell
+    Given executing "RESTART_VAR=set" succeeds
+     When the shell is restarted
+      And executing "echo ${RESTART_VAR:-unset}" succeeds
+     Then stdout should equal "unset"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:ksh
+  Scenario: Shell specific syntax
+     When executing "[[ abc == a* ]] && echo matched" succeeds
+     Then stdout should equal "matched"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Exit codes
+     When executing "(exit 3)" exits with code 3
+     Then exitcode should be one of "2,3"
+      And exitcode should be greater than 0
+      And exitcode should be less than 4
+     When executing "foobar" exits with "CommandNotFound"
+     Then exitcode should be one of "1, CommandNotFound"
+
+  @linux @darwin
+  Scenario: Command duration
+     When executing "sleep 0.2" succeeds
+     Then the last command should take more than "200ms"
+      And the last command should take less than "10s"
+     When setting scenario variable "DURATION" to the duration of the last command
+      And executing "echo $(DURATION)" succeeds
+     Then stdout should match "^[0-9.]+(ms|s)$"
+
+  @linux
+  Scenario: CPU time of commands
+     When executing "head -c 50000000 /dev/zero | tail -c 1 > /dev/null" succeeds
+     Then CPU time of the last command should be below "30s"
+
+  @linux @resource-usage
+  Scenario: Resource usage of commands
+     When executing "head -c 50000000 /dev/zero | tail -c 1 > /dev/null" succeeds
+     Then peak memory of the last command should be below "1GB"
+      And CPU time of the last command should be below "30s"
+     When executing "ls /" succeeds
+     Then peak memory of the last command should be below "1GB"
+     When executing "exit 3"
+     Then exitcode should equal "3"
+     When executing "echo alive" succeeds
+     Then stdout should equal "alive"
+     When running "true"
+     Then peak memory of the last command should be below "100MB"
+
+  @linux @darwin
+  Scenario: Benchmark
+     When benchmarking "true" 5 times
+     Then exitcode should equal "0"
+
+  @linux @darwin
+  Scenario: Benchmark baseline
+    Given executing "rm -f baseline.json" succeeds
+     When benchmarking "true" 3 times updating baseline "baseline.json"
+      And executing "cat baseline.json" succeeds
+     Then stdout should contain ""true": {"
+      And stdout should contain ""runs": 3"
+     When executing "sed 's/"[0-9][^"]*s"/"1m0s"/' baseline.json > slow.json" succeeds
+     Then benchmarking "true" 3 times against baseline "slow.json"
+     When executing "sed 's/"[0-9][^"]*s"/"1ns"/' baseline.json > fast.json" succeeds
+     Then the following steps fail with "regressed":
+      """
+      benchmarking "true" 3 times against baseline "fast.json"
+      """
+      And the following steps fail with "no benchmark baseline":
+      """
+      benchmarking "true; true" 1 times against baseline "slow.json"
+      """
+
+  @linux @darwin
+  Scenario: Retrying steps
+    Given executing "rm -f ready.txt counter.txt attempts.txt tries.txt" succeeds
+      And starting "sleep 0.5; touch ready.txt" in background as "creator"
+     Then within "10s" polling every "100ms" with backoff "1.5":
+      """
+      Then file "ready.txt" exists
+      And executing "echo -n x >> counter.txt" succeeds
+      And executing "cat counter.txt" succeeds
+      And stdout should contain "x"
+      """
+     When eventually executing "echo -n y >> attempts.txt; cat attempts.txt" until stdout matches "y{3}"
+     Then stdout should contain "yyy"
+     When within "5s" polling every "50ms" with backoff "1.2" executing "echo -n z >> tries.txt; cat tries.txt" until stdout matches "z{4}"
+     Then stdout should contain "zzzz"
+      And the following steps fail with "did not succeed within 300ms":
+      """
+      within "300ms" polling every "100ms" executing "echo waiting" until stdout matches "done"
+      """
+      And the following steps fail with "did not finish within":
+      """
+      within "500ms" polling every "100ms" executing "sleep 30" until exitcode matches "0"
+      """
+      And the following steps fail with "did not finish within":
+      """
+      within "500ms" polling every "100ms":
+        ```
+        When executing "sleep 30" succeeds
+        ```
+      """
+      And the following steps fail with "backoff factor '0' is below 1":
+      """
+      within "1s" polling every "100ms" with backoff "0" executing "echo waiting" until stdout matches "done"
+      """
+
+  @linux @darwin
+  Scenario: Condition holding over time
+    Given executing "echo Running > status.txt" succeeds
+     Then for "500ms" polling every "100ms" command "cat status.txt" stdout should contain "Running"
+      And for "300ms" polling every "100ms":
+      """
+      Then file "never.txt" should not exist
+      And executing "cat status.txt" succeeds
+      And stdout should equal "Running"
+      """
+
+  @linux @darwin
+  Scenario: Soft assertions
+    Given executing "printf 'name: test\nversion: 1\n' > soft.yml" succeeds
+     Then soft assertions:
+      """
+      Then content of file "soft.yml" should contain "name: test"
+      And content of file "soft.yml" should contain "version: 1"
+      And "YAML" config file "soft.yml" contains key "name" with value matching "test"
+      """
+      And the following steps fail with error matching "(?s)^step 'soft assertions:' failed: 3 of 4 soft assertions failed:\n.*'name: other'.*'version: 2'.*key missing":
+      """
+      Then soft assertions:
+        ```
+        Then content of file "soft.yml" should contain "name: other"
+        And content of file "soft.yml" should contain "version: 1"
+        And content of file "soft.yml" should contain "version: 2"
+        And "YAML" config file "soft.yml" contains key "missing"
+        ```
+      """
+
+  @linux @darwin
+  Scenario: Registering cleanup
+    Given executing "rm -f cleanup.txt" succeeds
+      And on cleanup executing "echo second >> cleanup.txt"
+      And on cleanup executing "echo first >> cleanup.txt"
+     Then file "cleanup.txt" should not exist
+
+  @linux @darwin
+  Scenario: Cleanup ran after the previous scenario
+     When executing "cat cleanup.txt" succeeds
+     Then stdout should equal
+      """
+      first
+      second
+      """
+
+  @linux @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Processes left behind
+    Given executing "sleep 300 &" succeeds
+      And executing "(sleep 301 &)" succeeds
+     When executing "pgrep -f 'sleep 30[01]' | wc -l" succeeds
+     Then stdout should contain "2"
+     When processes left behind are killed
+     Then no processes should be left behind
+     When executing "pgrep -f 'sleep 30[01]' | wc -l" succeeds
+     Then stdout should contain "0"
+
+  @linux @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Leaving a process behind
+    Given executing "sleep 302 &" succeeds
+     When executing "pgrep -f 'sleep 302' | wc -l" succeeds
+     Then stdout should contain "1"
+
+  @linux
+  Scenario: Processes left behind by the previous scenario are killed
+     When executing "pgrep -f 'sleep 302' | wc -l" succeeds
+     Then stdout should contain "0"
+
+  @linux @darwin @isolated
+  Scenario: Isolated scenario
+    Given executing "pwd" succeeds
+     Then stdout should equal "$(scenarioDir)"
+     When executing "echo $HOME" succeeds
+     Then stdout should equal "$(scenarioDir)/home"
+     When executing "echo $XDG_CONFIG_HOME" succeeds
+     Then stdout should equal "$(scenarioDir)/home/.config"
+     When creating file "isolated.txt" succeeds
+     Then file "$(scenarioDir)/isolated.txt" exists
+
+  @linux @darwin
+  Scenario: Scenario after an isolated one
+    Given file "isolated.txt" should not exist
+     When executing "pwd" succeeds
+     Then stdout should not contain "scenarios"
+     When executing "echo $HOME" succeeds
+     Then stdout should not contain "scenarios"
+
+  @linux @darwin
+  Scenario: Archiving the test run directory
+    Given creating file "archived.txt" succeeds
+     When archiving the test run directory as "whole run"
+     Then file "$(archiveDir)/archived.txt" exists
+      And executing "test -d '$(archiveDir)/scenarios'" succeeds
+
+  @linux @darwin @isolated
+  Scenario: Archiving an isolated scenario
+    Given creating file "isolated-archived.txt" succeeds
+     When archiving the test run directory as "isolated run"
+     Then file "$(archiveDir)/isolated-archived.txt" exists
+      And file "$(archiveDir)/archived.txt" should not exist
+      And directory "$(archiveDir)/scenarios" should not exist
+
+  @linux @darwin
+  Scenario: Setting environment variables
+    Given executing "echo before" succeeds
+     When setting environment variable "CLICUMBER_VALUE" to "it's a value"
+     Then stdout should equal "before"
+      And exitcode should equal "0"
+     Then environment variable "CLICUMBER_VALUE" should equal "it's a value"
+     When executing "echo $CLICUMBER_VALUE" succeeds
+     Then stdout should equal "it's a value"
+     When setting environment variable "HOME" to "/clicumber/home"
+     Then environment variable "HOME" should equal "/clicumber/home"
+     When setting environment variable "CLICUMBER_REMOVED" to "value"
+      And unsetting environment variable "CLICUMBER_REMOVED"
+     Then executing "printenv CLICUMBER_REMOVED" fails
+     When setting environment variable "CLICUMBER_SPECIAL" to ""quoted" 100% ^caret $HOME & more"
+      And executing "printenv CLICUMBER_SPECIAL" succeeds
+     Then stdout should equal ""quoted" 100% ^caret $HOME & more"
+
+  @linux @darwin
+  Scenario: Environment variables are restored after a scenario
+    Given executing "printenv CLICUMBER_VALUE" fails
+     When executing "echo $HOME" succeeds
+     Then stdout should not equal "/clicumber/home"
+
+  @linux @darwin
+  Scenario: Command finishing within timeout
+     When executing "sleep 1" with timeout "10s"
+     Then exitcode should equal "0"
+
+  @linux @darwin @shell:bash @shell:zsh @shell:sh @shell:dash @shell:ksh
+  Scenario: Command exceeding timeout
+     When executing "while true; do echo tick; sleep 0.01; done" times out after "500ms"
+     Then executing "echo restarted" succeeds
+      And stdout should equal "restarted"
+
   @linux @darwin
   Scenario: Able to use defined variable
     When executing "VAR=$(echo 'hello')" succeeds
@@ -0,0 +1,177 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+var (
+	// keepRunDir disables cleaning the test run directory before each
+	// feature
+	keepRunDir bool
+
+	// the test run directory is archived into the test results directory
+	// when a scenario fails, up to archiveMaxSize bytes of the files
+	// matching archiveInclude and not matching archiveExclude
+	archiveSize    string
+	archiveMaxSize int64
+	archiveInclude string
+	archiveExclude string
+
+	// currentFeature is the name of the running feature
+	currentFeature string
+)
+
+// ArchiveTestRunDir archives the test run directory like it is archived for
+// failed scenarios, under the given name. The path of the archive is
+// available as the scenario variable archiveDir.
+func ArchiveTestRunDir(name string) error {
+	destination, err := archiveTestRunDir(name)
+	if err != nil {
+		return err
+	}
+	util.SetScenarioVariable("archiveDir", destination)
+
+	return nil
+}
+
+// archiveTestRunDir copies the test run directory, or only the directory of
+// the scenario if it is isolated, into testResultsDir/<feature>/<scenario>
+// and returns the path of the copy.
+func archiveTestRunDir(scenario string) (string, error) {
+	source := testRunDir
+	if currentScenarioDir != "" {
+		source = currentScenarioDir
+	}
+
+	destination := filepath.Join(testResultsDir, directoryName(currentFeature), directoryName(scenario))
+	// scenarios of an outline share their name
+	for index := 2; ; index++ {
+		_, err := os.Stat(destination)
+		if os.IsNotExist(err) {
+			break
+		}
+		destination = filepath.Join(testResultsDir, directoryName(currentFeature), fmt.Sprintf("%s-%d", directoryName(scenario), index))
+	}
+
+	include, exclude := splitGlobs(archiveInclude), splitGlobs(archiveExclude)
+	var size int64
+	var skipped []string
+	err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relPath)
+
+		if relPath != "." && matchesGlob(relPath, exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, os.ModePerm)
+		case len(include) > 0 && !matchesGlob(relPath, include):
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		case archiveMaxSize > 0 && size+info.Size() > archiveMaxSize:
+			skipped = append(skipped, relPath)
+			return nil
+		}
+
+		size += info.Size()
+		return copyFile(path, target, info.Mode())
+	})
+	if err != nil {
+		return "", fmt.Errorf("error archiving test run directory: %v", err)
+	}
+
+	util.LogMessage("info", fmt.Sprintf("%s archived into %s", source, destination))
+	if len(skipped) > 0 {
+		util.LogMessage("info", fmt.Sprintf("files exceeding the archive size of %s were skipped:\n%s", archiveSize, strings.Join(skipped, "\n")))
+	}
+
+	return destination, nil
+}
+
+func splitGlobs(globs string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(globs, ",") {
+		if strings.TrimSpace(pattern) != "" {
+			patterns = append(patterns, strings.TrimSpace(pattern))
+		}
+	}
+
+	return patterns
+}
+
+// matchesGlob returns whether the relative path or its base name matches
+// one of the patterns.
+func matchesGlob(relPath string, patterns []string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, slashPath); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(relPath)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyFile(source string, destination string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
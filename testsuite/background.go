@@ -0,0 +1,267 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+const (
+	// backgroundOutputTimeout is the time the output of a background
+	// process is read for after it exited, processes it started may keep
+	// it open
+	backgroundOutputTimeout = 5 * time.Second
+
+	// backgroundStopTimeout is the time a killed background process is
+	// waited for
+	backgroundStopTimeout = backgroundOutputTimeout + 5*time.Second
+)
+
+var backgroundProcesses = make(map[string]*backgroundProcess)
+
+// backgroundProcess is a command started by the host shell which keeps
+// running while other steps are executed.
+type backgroundProcess struct {
+	name    string
+	command string
+
+	instance *exec.Cmd
+	outbuf   syncBuffer
+	errbuf   syncBuffer
+	pipes    []*os.File
+
+	// done is closed once the process exited and its output is read or
+	// backgroundOutputTimeout passed, outputClosed once stdout and stderr
+	// are closed
+	done         chan struct{}
+	exitCode     int
+	outputClosed chan struct{}
+}
+
+// syncBuffer is a bytes.Buffer which can be written by the process while
+// it is read by the steps.
+type syncBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(p []byte) (int, error) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return buffer.buffer.String()
+}
+
+func StartBackgroundProcess(command string, name string) error {
+	if _, exists := backgroundProcesses[name]; exists {
+		return fmt.Errorf("background process '%s' already exists", name)
+	}
+	if shell.name == "" {
+		return fmt.Errorf("shell instance is not started")
+	}
+
+	process := &backgroundProcess{
+		name:         name,
+		command:      command,
+		done:         make(chan struct{}),
+		outputClosed: make(chan struct{}),
+	}
+	process.instance = exec.Command(shell.name, shell.commandArgument, command)
+	setShellProcessAttributes(process.instance, nil)
+
+	// the output is read from pipes of our own, so that waiting for the
+	// process does not depend on processes it started closing them
+	outReader, outWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		outReader.Close()
+		outWriter.Close()
+		return err
+	}
+	process.instance.Stdout = outWriter
+	process.instance.Stderr = errWriter
+	process.pipes = []*os.File{outReader, errReader}
+
+	util.LogMessage(name, command)
+	err = process.instance.Start()
+	outWriter.Close()
+	errWriter.Close()
+	if err != nil {
+		process.closePipes()
+		return fmt.Errorf("error starting background process '%s': %v", name, err)
+	}
+	backgroundProcesses[name] = process
+
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go func() {
+		io.Copy(&process.outbuf, outReader)
+		readers.Done()
+	}()
+	go func() {
+		io.Copy(&process.errbuf, errReader)
+		readers.Done()
+	}()
+	go func() {
+		readers.Wait()
+		process.closePipes()
+		close(process.outputClosed)
+	}()
+
+	go func() {
+		process.instance.Wait()
+		select {
+		case <-process.outputClosed:
+		case <-time.After(backgroundOutputTimeout):
+			util.LogMessage(name, fmt.Sprintf("output still open %v after the process exited, closing it", backgroundOutputTimeout))
+			process.closePipes()
+		}
+		process.exitCode = processExitCode(process.instance.ProcessState)
+		util.LogMessage(name, fmt.Sprintf("exited with exit code %d\nstdout: %s\nstderr: %s",
+			process.exitCode, process.outbuf.String(), process.errbuf.String()))
+		close(process.done)
+	}()
+
+	return nil
+}
+
+func (process *backgroundProcess) closePipes() {
+	for _, pipe := range process.pipes {
+		pipe.Close()
+	}
+}
+
+func getBackgroundProcess(name string) (*backgroundProcess, error) {
+	process, exists := backgroundProcesses[name]
+	if !exists {
+		return nil, fmt.Errorf("background process '%s' does not exist", name)
+	}
+
+	return process, nil
+}
+
+func (process *backgroundProcess) getOutput(stdType string) string {
+	if stdType == "stderr" {
+		return process.errbuf.String()
+	}
+
+	return process.outbuf.String()
+}
+
+func BackgroundProcessOutputShouldContainWithin(name string, stdType string, expected string, timeout string) error {
+	process, err := getBackgroundProcess(name)
+	if err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(duration)
+	for !strings.Contains(process.getOutput(stdType), expected) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s of background process '%s' did not contain '%s' within %v. Actual: '%s'",
+				stdType, name, expected, duration, process.getOutput(stdType))
+		}
+
+		select {
+		case <-process.done:
+			if !strings.Contains(process.getOutput(stdType), expected) {
+				return fmt.Errorf("background process '%s' exited with exit code %d, %s did not contain '%s'. Actual: '%s'",
+					name, process.exitCode, stdType, expected, process.getOutput(stdType))
+			}
+		case <-time.After(outputPollInterval):
+		}
+	}
+
+	return nil
+}
+
+func SendSignalToBackgroundProcess(signal string, name string) error {
+	process, err := getBackgroundProcess(name)
+	if err != nil {
+		return err
+	}
+
+	util.LogMessage(name, fmt.Sprintf("sending signal %s", signal))
+	return signalProcess(process.instance, signal)
+}
+
+func BackgroundProcessExitsWithCode(name string, expected int) error {
+	process, err := getBackgroundProcess(name)
+	if err != nil {
+		return err
+	}
+
+	timeout := waitTimeout()
+	select {
+	case <-process.done:
+	case <-time.After(timeout):
+		return fmt.Errorf("background process '%s' did not exit within %v", name, timeout)
+	}
+
+	if process.exitCode != expected {
+		return fmt.Errorf("background process '%s' exited with exit code %d, expected %d\nstdout: %s\nstderr: %s",
+			name, process.exitCode, expected, process.outbuf.String(), process.errbuf.String())
+	}
+
+	return nil
+}
+
+// StopBackgroundProcesses kills all background processes which are still
+// running and forgets about all of them.
+func StopBackgroundProcesses() {
+	for name, process := range backgroundProcesses {
+		select {
+		case <-process.done:
+		default:
+			util.LogMessage(name, "still running, killing it")
+			err := killShellProcess(process.instance)
+			if err != nil {
+				util.LogMessage("info", fmt.Sprintf("error killing background process '%s': %v", name, err))
+			}
+			select {
+			case <-process.done:
+			case <-time.After(backgroundStopTimeout):
+				util.LogMessage(name, fmt.Sprintf("did not exit within %v after being killed, closing its output", backgroundStopTimeout))
+				process.closePipes()
+			}
+		}
+
+		delete(backgroundProcesses, name)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+var (
+	// benchmarkBaseline is the JSON file with the results commands are
+	// compared to, which is rewritten with the new results if
+	// benchmarkUpdate is set
+	benchmarkBaseline  string
+	benchmarkTolerance float64
+	benchmarkUpdate    bool
+)
+
+// jsonDuration is a time.Duration written as a string like "1.5ms".
+type jsonDuration time.Duration
+
+func (duration jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *jsonDuration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*duration = jsonDuration(parsed)
+
+	return nil
+}
+
+type benchmarkResult struct {
+	Runs   int          `json:"runs"`
+	Min    jsonDuration `json:"min"`
+	Median jsonDuration `json:"median"`
+	P95    jsonDuration `json:"p95"`
+}
+
+func (result benchmarkResult) String() string {
+	return fmt.Sprintf("%d runs, min %v, median %v, p95 %v",
+		result.Runs, time.Duration(result.Min), time.Duration(result.Median), time.Duration(result.P95))
+}
+
+// benchmarkBaselines holds the results of the baseline file per shell and
+// command.
+type benchmarkBaselines map[string]map[string]benchmarkResult
+
+// BenchmarkCommand runs command runs times and compares the durations to
+// the baseline given by -test-benchmark-baseline, if any.
+func BenchmarkCommand(command string, runs int) error {
+	return benchmarkCommand(command, runs, benchmarkBaseline, benchmarkUpdate)
+}
+
+func BenchmarkCommandAgainstBaseline(command string, runs int, baseline string) error {
+	return benchmarkCommand(command, runs, baseline, benchmarkUpdate)
+}
+
+func BenchmarkCommandUpdatingBaseline(command string, runs int, baseline string) error {
+	return benchmarkCommand(command, runs, baseline, true)
+}
+
+func benchmarkCommand(command string, runs int, baseline string, update bool) error {
+	if runs < 1 {
+		return fmt.Errorf("benchmark needs at least one run")
+	}
+
+	durations := make([]time.Duration, 0, runs)
+	for run := 0; run < runs; run++ {
+		err := shell.ExecuteCommand(command, commandTimeout)
+		if err != nil {
+			return err
+		}
+
+		exitCode := shell.GetLastCmdOutput("exitcode")
+		if exitCode != "0" {
+			return fmt.Errorf("command '%s' exited with exit code %s in run %d of the benchmark\nCommand stdout: %s\nCommand stderr: %s",
+				command, exitCode, run+1, shell.outbuf.String(), shell.errbuf.String())
+		}
+		durations = append(durations, shell.GetLastCmdDuration())
+	}
+
+	result := summarizeDurations(durations)
+	util.LogMessage("info", fmt.Sprintf("benchmark of '%s': %s", command, result))
+
+	if baseline == "" {
+		return nil
+	}
+	if update {
+		return updateBenchmarkBaseline(baseline, shell.name, command, result)
+	}
+
+	return compareWithBenchmarkBaseline(baseline, shell.name, command, result)
+}
+
+// summarizeDurations returns the minimum, the median and the 95th
+// percentile, by the nearest-rank method, of durations.
+func summarizeDurations(durations []time.Duration) benchmarkResult {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	count := len(sorted)
+	median := sorted[count/2]
+	if count%2 == 0 {
+		median = (sorted[count/2-1] + sorted[count/2]) / 2
+	}
+	p95 := sorted[int(math.Ceil(0.95*float64(count)))-1]
+
+	return benchmarkResult{
+		Runs:   count,
+		Min:    jsonDuration(sorted[0]),
+		Median: jsonDuration(median),
+		P95:    jsonDuration(p95),
+	}
+}
+
+func readBenchmarkBaselines(path string) (benchmarkBaselines, error) {
+	baselines := make(benchmarkBaselines)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading benchmark baseline: %v", err)
+	}
+
+	err = json.Unmarshal(data, &baselines)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing benchmark baseline '%s': %v", path, err)
+	}
+
+	return baselines, nil
+}
+
+func updateBenchmarkBaseline(path string, shellName string, command string, result benchmarkResult) error {
+	baselines, err := readBenchmarkBaselines(path)
+	if err != nil {
+		return err
+	}
+
+	if baselines[shellName] == nil {
+		baselines[shellName] = make(map[string]benchmarkResult)
+	}
+	baselines[shellName][command] = result
+
+	data, err := json.MarshalIndent(baselines, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing benchmark baseline: %v", err)
+	}
+	util.LogMessage("info", fmt.Sprintf("benchmark baseline of '%s' updated", command))
+
+	return nil
+}
+
+func compareWithBenchmarkBaseline(path string, shellName string, command string, result benchmarkResult) error {
+	baselines, err := readBenchmarkBaselines(path)
+	if err != nil {
+		return err
+	}
+
+	baseline, exists := baselines[shellName][command]
+	if !exists {
+		return fmt.Errorf("no benchmark baseline for '%s' in %s in '%s', run with -test-benchmark-update to record it", command, shellName, path)
+	}
+
+	var regressions []string
+	for _, value := range []struct {
+		name              string
+		actual, reference jsonDuration
+	}{
+		{"min", result.Min, baseline.Min},
+		{"median", result.Median, baseline.Median},
+		{"p95", result.P95, baseline.P95},
+	} {
+		limit := time.Duration(float64(value.reference) * (1 + benchmarkTolerance))
+		if time.Duration(value.actual) > limit {
+			regressions = append(regressions, fmt.Sprintf("%s %v exceeds baseline %v by more than %.0f%%",
+				value.name, time.Duration(value.actual), time.Duration(value.reference), benchmarkTolerance*100))
+		}
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("benchmark of '%s' regressed: %s", command, strings.Join(regressions, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+type cleanupAction struct {
+	description string
+	action      func() error
+}
+
+// cleanupActions are run after the current scenario
+var cleanupActions []cleanupAction
+
+// RegisterCleanup registers action to be run after the current scenario,
+// whether it passed or failed. Actions run in the reverse order of their
+// registration.
+func RegisterCleanup(action func() error) {
+	cleanupActions = append(cleanupActions, cleanupAction{"registered function", action})
+}
+
+func ExecuteCommandOnCleanup(command string) error {
+	cleanupActions = append(cleanupActions, cleanupAction{command, func() error {
+		// the scenario may have left the shell exited
+		err := shell.RestartIfExited()
+		if err != nil {
+			return err
+		}
+
+		err = ExecuteCommand(command)
+		if err != nil {
+			return err
+		}
+
+		exitCode := shell.GetLastCmdOutput("exitcode")
+		if exitCode != "0" {
+			return fmt.Errorf("exited with exit code %s\nCommand stdout: %s\nCommand stderr: %s", exitCode, shell.outbuf.String(), shell.errbuf.String())
+		}
+
+		return nil
+	}})
+
+	return nil
+}
+
+// RunCleanups runs the registered cleanup actions in reverse order and
+// logs their failures.
+func RunCleanups() {
+	for index := len(cleanupActions) - 1; index >= 0; index-- {
+		cleanup := cleanupActions[index]
+		util.LogMessage("cleanup", cleanup.description)
+
+		err := cleanup.action()
+		if err != nil {
+			util.LogMessage("cleanup", fmt.Sprintf("'%s' failed: %v", cleanup.description, err))
+		}
+	}
+
+	cleanupActions = nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/messages-go/v10"
+)
+
+func RunCommand(program string) error {
+	return shell.RunCommand(program, nil, commandTimeout)
+}
+
+// RunCommandWithArguments runs program with the cells of the data table,
+// read row by row, as its arguments. Scenario variables in the cells are
+// replaced like in the step text.
+func RunCommandWithArguments(program string, arguments *messages.PickleStepArgument_PickleTable) error {
+	var args []string
+	for _, row := range arguments.Rows {
+		for _, cell := range row.Cells {
+			args = append(args, util.ProcessScenarioVariables(cell.Value))
+		}
+	}
+
+	return shell.RunCommand(program, args, commandTimeout)
+}
+
+// RunCommand executes program directly, without passing it through the
+// shell, so the arguments reach it unchanged regardless of the shell type.
+// Its output and exit code are stored like the ones of commands executed
+// in the shell. The program runs in the working directory of the test
+// process, not in the current directory of the shell.
+func (shell *ShellInstance) RunCommand(program string, args []string, timeout time.Duration) error {
+	shell.bufferLock.Lock()
+	shell.outbuf.Reset()
+	shell.errbuf.Reset()
+	shell.ttybuf.Reset()
+	shell.bufferLock.Unlock()
+	shell.excbuf.Reset()
+	shell.lastUsage = nil
+
+	util.LogMessage("run", strings.Join(append([]string{program}, args...), " "))
+
+	// the peak memory is recorded by running the program with the
+	// run-usage helper
+	var cmd *exec.Cmd
+	report := ""
+	if recordingPeakUsage() {
+		var err error
+		report, err = newUsageReport()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(report)
+
+		cmd, err = helperProcess(runUsageHelper, append([]string{report, program}, args...)...)
+		if err != nil {
+			return err
+		}
+	} else {
+		cmd = exec.Command(program, args...)
+	}
+
+	var stdout, stderr syncBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setShellProcessAttributes(cmd, nil)
+
+	shell.commandStarted = time.Now()
+	err := cmd.Start()
+	// a missing program is reported like the shells do
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		message := fmt.Sprintf("%s: command not found", program)
+		util.LogOutput("stderr", message)
+		shell.bufferLock.Lock()
+		shell.errbuf.WriteString(message + "\n")
+		shell.bufferLock.Unlock()
+		shell.excbuf.WriteString("127")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error running '%s': %v", program, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	var timeoutChannel <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChannel = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-timeoutChannel:
+		killShellProcess(cmd)
+		<-done
+		return fmt.Errorf("command '%s' did not finish within %v\nCommand stdout: %s\nCommand stderr: %s", program, timeout, stdout.String(), stderr.String())
+	}
+
+	shell.lastDuration = time.Since(shell.commandStarted)
+	util.LogMessage("info", fmt.Sprintf("command finished in %v", shell.lastDuration))
+	shell.recordUsage(strings.Join(append([]string{program}, args...), " "), processUsage(cmd.ProcessState, report))
+	util.LogOutput("stdout", stdout.String())
+	util.LogOutput("stderr", stderr.String())
+
+	shell.bufferLock.Lock()
+	shell.outbuf.WriteString(stdout.String())
+	shell.errbuf.WriteString(stderr.String())
+	shell.bufferLock.Unlock()
+	shell.excbuf.WriteString(strconv.Itoa(processExitCode(cmd.ProcessState)))
+
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+// GetLastCmdDuration returns the wall-clock time the last command took.
+func (shell *ShellInstance) GetLastCmdDuration() time.Duration {
+	return shell.lastDuration
+}
+
+func LastCommandShouldTake(comparison string, limit string) error {
+	duration, err := time.ParseDuration(limit)
+	if err != nil {
+		return err
+	}
+
+	lastDuration := shell.GetLastCmdDuration()
+	if comparison == "less" && lastDuration >= duration {
+		return fmt.Errorf("last command took %v, expected less than %v", lastDuration, duration)
+	}
+	if comparison == "more" && lastDuration <= duration {
+		return fmt.Errorf("last command took %v, expected more than %v", lastDuration, duration)
+	}
+
+	return nil
+}
+
+func SetScenarioVariableToLastCmdDuration(variableName string) error {
+	util.SetScenarioVariable(variableName, shell.GetLastCmdDuration().String())
+
+	return nil
+}
@@ -0,0 +1,303 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+// environmentChange is the state of an environment variable before the
+// scenario changed it, in the test process and in the host shell.
+type environmentChange struct {
+	name         string
+	processValue string
+	processSet   bool
+	shellValue   string
+	shellSet     bool
+}
+
+var (
+	// environmentChanges are undone by RestoreEnvironment
+	environmentChanges []environmentChange
+
+	// previousWorkingDir is the working directory before the scenario
+	// changed it, empty if it did not
+	previousWorkingDir string
+
+	environmentVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// SetEnvironmentVariable sets the variable in the shell until the end of the
+// scenario.
+func SetEnvironmentVariable(name string, value string) error {
+	if !environmentVariableName.MatchString(name) {
+		return fmt.Errorf("invalid name of environment variable: '%s'", name)
+	}
+
+	return changeEnvironmentVariable(name, value, true)
+}
+
+// UnsetEnvironmentVariable unsets the variable in the shell until the end of
+// the scenario.
+func UnsetEnvironmentVariable(name string) error {
+	if !environmentVariableName.MatchString(name) {
+		return fmt.Errorf("invalid name of environment variable: '%s'", name)
+	}
+
+	return changeEnvironmentVariable(name, "", false)
+}
+
+func EnvironmentVariableShouldEqual(name string, expected string) error {
+	if !environmentVariableName.MatchString(name) {
+		return fmt.Errorf("invalid name of environment variable: '%s'", name)
+	}
+
+	value, set, err := shell.getEnvironmentVariable(name)
+	if err != nil {
+		return err
+	}
+	if !set {
+		return fmt.Errorf("environment variable %s is not set, expected: '%s'", name, expected)
+	}
+	if value != expected {
+		return fmt.Errorf("environment variable %s does not equal. Expected: '%s', Actual: '%s'", name, expected, value)
+	}
+
+	return nil
+}
+
+// quote quotes value so that the shell passes it on as one argument. cmd
+// cannot quote every character, the value is returned as is for it.
+func (shell *ShellInstance) quote(value string) string {
+	switch shell.name {
+	case "cmd":
+		return value
+	case "fish":
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	case "powershell":
+		return "'" + strings.Replace(value, "'", "''", -1) + "'"
+	default:
+		return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+	}
+}
+
+// executeInternalCommand runs a command the testsuite uses to manage the
+// shell and returns its stdout and exit code. The output, exit code,
+// duration and resource usage of the last command are kept, and the
+// resources the command used are not recorded.
+func (shell *ShellInstance) executeInternalCommand(command string) (string, string, error) {
+	shell.bufferLock.Lock()
+	stdout, stderr := shell.outbuf.String(), shell.errbuf.String()
+	shell.bufferLock.Unlock()
+	exitCode := shell.excbuf.String()
+	duration, usage := shell.lastDuration, shell.lastUsage
+
+	shell.internalCommand = true
+	err := shell.executeCommand(command, commandTimeout, false)
+	shell.internalCommand = false
+	output, internalExitCode := shell.GetLastCmdOutput("stdout"), shell.GetLastCmdOutput("exitcode")
+
+	shell.bufferLock.Lock()
+	shell.outbuf.Reset()
+	shell.outbuf.WriteString(stdout)
+	shell.errbuf.Reset()
+	shell.errbuf.WriteString(stderr)
+	shell.bufferLock.Unlock()
+	shell.excbuf.Reset()
+	shell.excbuf.WriteString(exitCode)
+	shell.lastDuration, shell.lastUsage = duration, usage
+
+	return output, internalExitCode, err
+}
+
+// executeInternalCommandSucceeds runs command like executeInternalCommand
+// and fails if it does not exit with exit code 0.
+func (shell *ShellInstance) executeInternalCommandSucceeds(command string) error {
+	_, exitCode, err := shell.executeInternalCommand(command)
+	if err != nil {
+		return err
+	}
+	if exitCode != "0" {
+		return fmt.Errorf("command '%s' exited with exit code: %s", command, exitCode)
+	}
+
+	return nil
+}
+
+// valueArgument returns value in the form the commands setting variables
+// and changing the directory take it. For cmd, which cannot quote every
+// character, it is written to a file whose path is returned, remove
+// deletes the file.
+func (shell *ShellInstance) valueArgument(value string) (argument string, remove func(), err error) {
+	if shell.name != "cmd" {
+		return shell.quote(value), func() {}, nil
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", nil, fmt.Errorf("values with line breaks are not supported by cmd")
+	}
+
+	file, err := ioutil.TempFile("", "clicumber-value-*")
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = file.WriteString(value + "\r\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", nil, err
+	}
+
+	return file.Name(), func() { os.Remove(file.Name()) }, nil
+}
+
+// getEnvironmentVariable returns the value of the variable in the shell and
+// whether it is set.
+func (shell *ShellInstance) getEnvironmentVariable(name string) (string, bool, error) {
+	value, exitCode, err := shell.executeInternalCommand(fmt.Sprintf(shell.getEnvCommand, name))
+	if err != nil {
+		return "", false, err
+	}
+	if exitCode != "0" {
+		return "", false, nil
+	}
+
+	return value, true, nil
+}
+
+func (shell *ShellInstance) setEnvironmentVariable(name string, value string) error {
+	// cmd cannot hold empty variables
+	if value == "" && shell.name == "cmd" {
+		return shell.unsetEnvironmentVariable(name)
+	}
+
+	argument, remove, err := shell.valueArgument(value)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	return shell.executeInternalCommandSucceeds(fmt.Sprintf(shell.setEnvCommand, name, argument))
+}
+
+func (shell *ShellInstance) changeDirectory(dir string) error {
+	argument, remove, err := shell.valueArgument(dir)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	return shell.executeInternalCommandSucceeds(fmt.Sprintf(shell.changeDirCommand, argument))
+}
+
+func (shell *ShellInstance) unsetEnvironmentVariable(name string) error {
+	_, _, err := shell.executeInternalCommand(fmt.Sprintf(shell.unsetEnvCommand, name))
+	return err
+}
+
+// changeEnvironmentVariable sets the variable to value, or unsets it if set
+// is false, in the test process and in the host shell, so that restarted
+// shells and commands run directly get it too. The previous state is
+// restored by RestoreEnvironment.
+func changeEnvironmentVariable(name string, value string, set bool) error {
+	change := environmentChange{name: name}
+	change.processValue, change.processSet = os.LookupEnv(name)
+
+	var err error
+	change.shellValue, change.shellSet, err = shell.getEnvironmentVariable(name)
+	if err != nil {
+		return err
+	}
+	environmentChanges = append(environmentChanges, change)
+
+	if !set {
+		os.Unsetenv(name)
+		return shell.unsetEnvironmentVariable(name)
+	}
+
+	os.Setenv(name, value)
+	return shell.setEnvironmentVariable(name, value)
+}
+
+// changeWorkingDirectory changes the working directory of the test process
+// and of the host shell to dir until RestoreEnvironment is called.
+func changeWorkingDirectory(dir string) error {
+	if previousWorkingDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		previousWorkingDir = wd
+	}
+
+	err := os.Chdir(dir)
+	if err != nil {
+		return err
+	}
+
+	return shell.changeDirectory(dir)
+}
+
+// RestoreEnvironment undoes the changes of environment variables and of the
+// working directory made during the scenario, in reverse order.
+func RestoreEnvironment() {
+	// a shell which exited is restarted with the restored environment of
+	// the test process before the next scenario
+	shellRunning := shell.instance != nil
+
+	for index := len(environmentChanges) - 1; index >= 0; index-- {
+		change := environmentChanges[index]
+		if change.processSet {
+			os.Setenv(change.name, change.processValue)
+		} else {
+			os.Unsetenv(change.name)
+		}
+
+		if !shellRunning {
+			continue
+		}
+		var err error
+		if change.shellSet {
+			err = shell.setEnvironmentVariable(change.name, change.shellValue)
+		} else {
+			err = shell.unsetEnvironmentVariable(change.name)
+		}
+		if err != nil {
+			util.LogMessage("info", fmt.Sprintf("error restoring environment variable %s: %v", change.name, err))
+		}
+	}
+	environmentChanges = nil
+
+	if previousWorkingDir == "" {
+		return
+	}
+	err := os.Chdir(previousWorkingDir)
+	if err == nil && shellRunning {
+		err = shell.changeDirectory(previousWorkingDir)
+	}
+	if err != nil {
+		util.LogMessage("info", fmt.Sprintf("error restoring working directory %s: %v", previousWorkingDir, err))
+	}
+	previousWorkingDir = ""
+}
@@ -0,0 +1,142 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	exitCodesFile string
+
+	// exitCodeNames maps names of documented exit codes to their values
+	exitCodeNames = make(map[string]int)
+)
+
+// RegisterExitCode makes code available under name in the exit code steps.
+func RegisterExitCode(name string, code int) {
+	exitCodeNames[name] = code
+}
+
+// LoadExitCodes registers the exit codes of a JSON or YAML file mapping
+// names to exit codes.
+func LoadExitCodes(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading exit codes from '%s': %v", path, err)
+	}
+
+	var codes map[string]int
+	err = yaml.Unmarshal(data, &codes)
+	if err != nil {
+		return fmt.Errorf("error parsing exit codes from '%s': %v", path, err)
+	}
+
+	for name, code := range codes {
+		RegisterExitCode(name, code)
+	}
+
+	return nil
+}
+
+// parseExitCode returns the exit code registered as value, or value itself
+// if it is a number.
+func parseExitCode(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if code, exists := exitCodeNames[value]; exists {
+		return code, nil
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("exit code '%s' is neither a number nor a registered name", value)
+	}
+
+	return code, nil
+}
+
+func lastExitCode() (int, error) {
+	exitCode := shell.GetLastCmdOutput("exitcode")
+	code, err := strconv.Atoi(exitCode)
+	if err != nil {
+		return 0, fmt.Errorf("exit code of the last command is not known: '%s'", exitCode)
+	}
+
+	return code, nil
+}
+
+func ExecuteCommandExitsWithCode(command string, expected string) error {
+	expectedCode, err := parseExitCode(expected)
+	if err != nil {
+		return err
+	}
+
+	err = ExecuteCommand(command)
+	if err != nil {
+		return err
+	}
+
+	code, err := lastExitCode()
+	if err != nil {
+		return err
+	}
+	if code != expectedCode {
+		return fmt.Errorf("command '%s', expected to exit with exit code %d, exited with exit code: %d\nCommand stdout: %s\nCommand stderr: %s", command, expectedCode, code, shell.outbuf.String(), shell.errbuf.String())
+	}
+
+	return nil
+}
+
+func ExitCodeShouldBeOneOf(expected string) error {
+	code, err := lastExitCode()
+	if err != nil {
+		return err
+	}
+
+	for _, value := range strings.Split(expected, ",") {
+		expectedCode, err := parseExitCode(value)
+		if err != nil {
+			return err
+		}
+		if code == expectedCode {
+			return nil
+		}
+	}
+
+	return withFailedScriptLine("exitcode", fmt.Errorf("exit code %d is not one of '%s'", code, expected))
+}
+
+func ExitCodeShouldCompare(comparison string, expected int) error {
+	code, err := lastExitCode()
+	if err != nil {
+		return err
+	}
+
+	if comparison == "greater" && code <= expected {
+		return withFailedScriptLine("exitcode", fmt.Errorf("exit code %d is not greater than %d", code, expected))
+	}
+	if comparison == "less" && code >= expected {
+		return withFailedScriptLine("exitcode", fmt.Errorf("exit code %d is not less than %d", code, expected))
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Helpers are small programs built into the test binary, which commands
+// executed by the shell run by executing the test binary with
+// helperVariable set to the name of the helper.
+const (
+	helperVariable = "CLICUMBER_HELPER"
+
+	terminalHelper  = "terminal"
+	exitUsageHelper = "exit-usage"
+	runUsageHelper  = "run-usage"
+)
+
+func init() {
+	name := os.Getenv(helperVariable)
+	if name == "" {
+		return
+	}
+	os.Unsetenv(helperVariable)
+
+	err := runHelper(name, os.Args[1:])
+	fmt.Fprintf(os.Stderr, "clicumber %s helper: %v\n", name, err)
+	os.Exit(127)
+}
+
+// runHelper runs the named helper, it only returns if the helper fails.
+func runHelper(name string, args []string) error {
+	switch name {
+	case terminalHelper:
+		return runInTerminal(args)
+	case exitUsageHelper:
+		return exitWithUsage(args)
+	case runUsageHelper:
+		return runWithUsage(args)
+	default:
+		return fmt.Errorf("unknown helper")
+	}
+}
+
+// helperProcess returns the command which runs the named helper with the
+// given arguments from the test process.
+func helperProcess(name string, args ...string) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("error finding the test binary: %v", err)
+	}
+
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(os.Environ(), helperVariable+"="+name)
+
+	return cmd, nil
+}
+
+// helperCommand returns the command which runs the named helper with the
+// given arguments, quoted for the shell.
+func (shell *ShellInstance) helperCommand(name string, args ...string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error finding the test binary: %v", err)
+	}
+
+	command := []string{"env", helperVariable + "=" + name, shell.quote(executable)}
+	for _, arg := range args {
+		command = append(command, shell.quote(arg))
+	}
+
+	return strings.Join(command, " "), nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+const (
+	// defaultWaitTimeout is used for waiting on interactive commands,
+	// background processes and eventual results when no command timeout
+	// is set
+	defaultWaitTimeout = time.Minute
+	outputPollInterval = 50 * time.Millisecond
+	maskedSecret       = "********"
+)
+
+var interactiveCommand string
+
+func waitTimeout() time.Duration {
+	if commandTimeout > 0 {
+		return commandTimeout
+	}
+
+	return defaultWaitTimeout
+}
+
+// ExecuteCommandInteractively starts command in a terminal and returns
+// without waiting for it to finish, so that input can be sent to it.
+func ExecuteCommandInteractively(command string) error {
+	if interactiveCommand != "" {
+		return fmt.Errorf("interactive command '%s' is still running", interactiveCommand)
+	}
+
+	shell.interactiveOffset = 0
+	err := shell.startCommand(command, true)
+	if err != nil {
+		return err
+	}
+	interactiveCommand = command
+
+	return nil
+}
+
+// SendInputOnOutput waits until the interactive command prints expected
+// and then sends input followed by a newline to it.
+func SendInputOnOutput(expected string, input string) error {
+	return sendInputOnOutput(expected, input, false)
+}
+
+// SendSecretOnOutput works like SendInputOnOutput, but masks input in the
+// log.
+func SendSecretOnOutput(expected string, secret string) error {
+	return sendInputOnOutput(expected, secret, true)
+}
+
+func sendInputOnOutput(expected string, input string, secret bool) error {
+	if interactiveCommand == "" {
+		return errors.New("no interactive command is running")
+	}
+
+	err := shell.waitForOutput(expected, waitTimeout())
+	if err != nil {
+		command := interactiveCommand
+		interactiveCommand = ""
+		shell.Restart()
+		return fmt.Errorf("interactive command '%s': %v", command, err)
+	}
+
+	logged := input
+	if secret {
+		shell.bufferLock.Lock()
+		shell.secrets = append(shell.secrets, input)
+		shell.bufferLock.Unlock()
+		logged = maskedSecret
+	}
+	util.LogMessage("send", logged)
+
+	_, err = io.WriteString(shell.terminal.master, input+"\n")
+
+	return err
+}
+
+// InteractiveCommandExitsWithCode waits until the interactive command
+// finishes and checks its exit code.
+func InteractiveCommandExitsWithCode(expected string) error {
+	if interactiveCommand == "" {
+		return errors.New("no interactive command is running")
+	}
+
+	command := interactiveCommand
+	interactiveCommand = ""
+	err := shell.waitForCommand(command, waitTimeout(), true)
+	if err != nil {
+		return err
+	}
+
+	exitCode := shell.GetLastCmdOutput("exitcode")
+	if exitCode != expected {
+		return fmt.Errorf("interactive command '%s' exited with exit code %s, expected %s\nCommand output: %s", command, exitCode, expected, shell.maskSecrets(shell.GetLastCmdOutput("stdout")))
+	}
+
+	return nil
+}
+
+// StopInteractiveCommand restarts the shell if the interactive command of
+// the scenario is still running and forgets the secrets sent to it.
+func StopInteractiveCommand() {
+	if interactiveCommand != "" {
+		util.LogMessage("info", fmt.Sprintf("interactive command '%s' is still running, restarting the shell", interactiveCommand))
+		interactiveCommand = ""
+		shell.usageMonitor.Stop()
+		shell.usageMonitor = nil
+		if shell.usageReport != "" {
+			os.Remove(shell.usageReport)
+			shell.usageReport = ""
+		}
+
+		err := shell.Restart()
+		if err != nil {
+			fmt.Println("error restarting shell instance:", err)
+		}
+	}
+
+	shell.bufferLock.Lock()
+	shell.secrets = nil
+	shell.bufferLock.Unlock()
+}
+
+// waitForOutput waits until expected appears in the terminal output which
+// has not been matched yet.
+func (shell *ShellInstance) waitForOutput(expected string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		shell.bufferLock.Lock()
+		output := shell.ttybuf.Bytes()[shell.interactiveOffset:]
+		index := bytes.Index(output, []byte(expected))
+		if index >= 0 {
+			shell.interactiveOffset += index + len(expected)
+		}
+		transcript := string(output)
+		shell.bufferLock.Unlock()
+
+		if index >= 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("output '%s' did not appear within %v\nOutput: %s", expected, timeout, shell.maskSecrets(transcript))
+		}
+
+		time.Sleep(outputPollInterval)
+	}
+}
+
+// maskSecrets replaces the secrets sent to interactive commands in text.
+// The caller must not hold bufferLock.
+func (shell *ShellInstance) maskSecrets(text string) string {
+	shell.bufferLock.Lock()
+	defer shell.bufferLock.Unlock()
+
+	for _, secret := range shell.secrets {
+		text = strings.Replace(text, secret, maskedSecret, -1)
+	}
+
+	return text
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/messages-go/v10"
+)
+
+const (
+	isolatedTag = "@isolated"
+
+	// scenarioSetUpStep replaces the first step of a scenario which could
+	// not be set up
+	scenarioSetUpStep = "the scenario is set up"
+)
+
+var (
+	// testIsolated isolates all scenarios, not only those tagged with
+	// @isolated
+	testIsolated bool
+
+	isolatedScenarios int
+
+	// currentScenarioDir is the directory of the running scenario if it is
+	// isolated
+	currentScenarioDir string
+
+	// scenarioSetupError is the error isolating the scenario. Hooks cannot
+	// fail scenarios, so it fails the first step instead.
+	scenarioSetupError error
+
+	unsafePathCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// directoryName turns name into a name usable for a directory.
+func directoryName(name string) string {
+	return strings.Trim(unsafePathCharacters.ReplaceAllString(name, "-"), "-")
+}
+
+func hasTag(pickle *messages.Pickle, name string) bool {
+	for _, tag := range pickle.Tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isolateScenario runs the scenario in a fresh directory of its own under
+// the test run directory, with HOME and the XDG base directories pointing
+// into it. The directory is available as the scenario variable scenarioDir.
+// Named shell sessions are not isolated.
+func isolateScenario(pickle *messages.Pickle) error {
+	currentScenarioDir = ""
+	if !testIsolated && !hasTag(pickle, isolatedTag) {
+		return nil
+	}
+
+	isolatedScenarios++
+	scenarioDir := filepath.Join(testRunDir, "scenarios", fmt.Sprintf("%d-%s", isolatedScenarios, directoryName(pickle.Name)))
+	home := filepath.Join(scenarioDir, "home")
+
+	variables := [][2]string{
+		{"HOME", home},
+		{"XDG_CONFIG_HOME", filepath.Join(home, ".config")},
+		{"XDG_CACHE_HOME", filepath.Join(home, ".cache")},
+		{"XDG_DATA_HOME", filepath.Join(home, ".local", "share")},
+		{"XDG_STATE_HOME", filepath.Join(home, ".local", "state")},
+	}
+	if runtime.GOOS == "windows" {
+		variables = append(variables, [2]string{"USERPROFILE", home})
+	}
+
+	// with -keep-run-dir the directory may be left from an earlier run
+	err := os.RemoveAll(scenarioDir)
+	if err != nil {
+		return fmt.Errorf("error removing isolated directory of an earlier run: %v", err)
+	}
+	for _, variable := range variables {
+		err := os.MkdirAll(variable[1], os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("error creating isolated directory: %v", err)
+		}
+	}
+
+	for _, variable := range variables {
+		err := changeEnvironmentVariable(variable[0], variable[1], true)
+		if err != nil {
+			return fmt.Errorf("error setting %s of isolated scenario: %v", variable[0], err)
+		}
+	}
+
+	err = changeWorkingDirectory(scenarioDir)
+	if err != nil {
+		return fmt.Errorf("error changing to isolated directory: %v", err)
+	}
+
+	currentScenarioDir = scenarioDir
+	util.SetScenarioVariable("scenarioDir", scenarioDir)
+	util.LogMessage("info", fmt.Sprintf("scenario isolated in %s", scenarioDir))
+
+	return nil
+}
+
+// failStepOnSetupError makes the step fail with the error setting up the
+// scenario, if there is one.
+func failStepOnSetupError(step *messages.Pickle_PickleStep) {
+	if scenarioSetupError == nil {
+		return
+	}
+
+	step.Text = scenarioSetUpStep
+	step.Argument = nil
+}
+
+// ScenarioIsSetUp returns the error setting up the scenario, once.
+func ScenarioIsSetUp() error {
+	err := scenarioSetupError
+	scenarioSetupError = nil
+
+	return err
+}
@@ -0,0 +1,270 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/cucumber/godog"
+	"github.com/cucumber/messages-go/v10"
+)
+
+var (
+	testWithShells string
+
+	// testShellPass is the shell of the current pass when the features are
+	// run once for each of testWithShells
+	testShellPass string
+
+	// supportedShells are the shells ConfigureTypeOfShell knows, scenarios
+	// tagged with @shell:<name> of some of them are run with those only
+	supportedShells = []string{"bash", "zsh", "fish", "tcsh", "sh", "dash", "ksh", "cmd", "powershell"}
+)
+
+// RunWithOptions runs the features like godog.RunWithOptions. If shells are
+// given by -test-shells, the features are run once with each of them, every
+// pass with its own test run directory and log and with the shell appended
+// to the names of features and scenarios. The reports of the cucumber and
+// junit formats of all passes are merged into one.
+func RunWithOptions(suiteName string, contextInitializer func(*godog.Suite), options godog.Options) int {
+	var shells []string
+	for _, name := range strings.Split(testWithShells, ",") {
+		if strings.TrimSpace(name) != "" {
+			shells = append(shells, strings.TrimSpace(name))
+		}
+	}
+
+	if len(shells) == 0 {
+		options.Tags = withShellTags(options.Tags, shellNameOrDefault(testWithShell))
+		return leftoverProcessesStatus(godog.RunWithOptions(suiteName, contextInitializer, options))
+	}
+
+	// the working directory is changed to the test run directory of each
+	// pass, every pass starts in the original one
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error getting working directory:", err)
+		return 1
+	}
+	for index, path := range options.Paths {
+		absPath, err := filepath.Abs(path)
+		if err == nil {
+			options.Paths[index] = absPath
+		}
+	}
+
+	var output io.Writer = os.Stdout
+	if options.Output != nil {
+		output = options.Output
+	}
+	mergeReports := options.Format == "cucumber" || options.Format == "junit"
+
+	var reports [][]byte
+	status := 0
+	for _, name := range shells {
+		if !mergeReports {
+			fmt.Fprintf(output, "----- Running features with %s -----\n", name)
+		}
+
+		err := os.Chdir(wd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error changing working directory:", err)
+			return 1
+		}
+
+		testWithShell = name
+		testShellPass = name
+		shell = ShellInstance{}
+
+		var report bytes.Buffer
+		passOptions := options
+		passOptions.Tags = withShellTags(options.Tags, name)
+		if mergeReports {
+			passOptions.Output = &report
+		}
+
+		passStatus := godog.RunWithOptions(suiteName, contextInitializer, passOptions)
+		if passStatus > status {
+			status = passStatus
+		}
+		reports = append(reports, report.Bytes())
+	}
+
+	if mergeReports {
+		var err error
+		if options.Format == "cucumber" {
+			err = mergeCucumberReports(output, reports)
+		} else {
+			err = mergeJunitReports(output, suiteName, reports)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error merging reports:", err)
+			return 1
+		}
+	}
+
+	return leftoverProcessesStatus(status)
+}
+
+// withShellTags adds a tag filter to tags which skips the scenarios tagged
+// with @shell:<name> of other shells only.
+func withShellTags(tags string, shellName string) string {
+	if shellName == "" {
+		return tags
+	}
+
+	var filters []string
+	if tags != "" {
+		filters = append(filters, tags)
+	}
+	for _, other := range supportedShells {
+		if other != shellName {
+			filters = append(filters, fmt.Sprintf("~@shell:%s,@shell:%s", other, shellName))
+		}
+	}
+
+	return strings.Join(filters, " && ")
+}
+
+// shellNameOrDefault returns the name of the shell ConfigureTypeOfShell
+// configures for name.
+func shellNameOrDefault(name string) string {
+	for _, supported := range supportedShells {
+		if name == supported {
+			return name
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+
+	return "bash"
+}
+
+// withShellPass appends the shell of the current pass to name.
+func withShellPass(name string) string {
+	if testShellPass == "" {
+		return name
+	}
+
+	return fmt.Sprintf("%s [%s]", name, testShellPass)
+}
+
+// nameFeatureWithShellPass appends the shell of the current pass to the
+// names of the feature and its scenarios, which are used in the reports.
+func nameFeatureWithShellPass(document *messages.GherkinDocument) {
+	if testShellPass == "" || document.Feature == nil {
+		return
+	}
+
+	document.Feature.Name = withShellPass(document.Feature.Name)
+	for _, child := range document.Feature.Children {
+		if scenario := child.GetScenario(); scenario != nil {
+			scenario.Name = withShellPass(scenario.Name)
+		}
+		if rule := child.GetRule(); rule != nil {
+			for _, ruleChild := range rule.Children {
+				if scenario := ruleChild.GetScenario(); scenario != nil {
+					scenario.Name = withShellPass(scenario.Name)
+				}
+			}
+		}
+	}
+}
+
+func mergeCucumberReports(output io.Writer, reports [][]byte) error {
+	var features []json.RawMessage
+	for _, report := range reports {
+		var passFeatures []json.RawMessage
+		err := json.Unmarshal(report, &passFeatures)
+		if err != nil {
+			return err
+		}
+		features = append(features, passFeatures...)
+	}
+
+	merged, err := json.MarshalIndent(features, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "%s\n", merged)
+
+	return err
+}
+
+type junitReport struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite keeps a test suite of a report as it is
+type junitSuite struct {
+	XMLName xml.Name   `xml:"testsuite"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+func mergeJunitReports(output io.Writer, suiteName string, reports [][]byte) error {
+	merged := junitReport{Name: suiteName}
+	var seconds float64
+	for _, report := range reports {
+		var passReport junitReport
+		err := xml.Unmarshal(report, &passReport)
+		if err != nil {
+			return err
+		}
+
+		merged.Tests += passReport.Tests
+		merged.Skipped += passReport.Skipped
+		merged.Failures += passReport.Failures
+		merged.Errors += passReport.Errors
+		passSeconds, _ := strconv.ParseFloat(passReport.Time, 64)
+		seconds += passSeconds
+		merged.Suites = append(merged.Suites, passReport.Suites...)
+	}
+	merged.Time = strconv.FormatFloat(seconds, 'f', -1, 64)
+
+	_, err := io.WriteString(output, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(output)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(merged)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(output, "\n")
+
+	return err
+}
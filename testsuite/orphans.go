@@ -0,0 +1,129 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+var (
+	// strictProcesses fails the test run if scenarios leave processes
+	// behind
+	strictProcesses bool
+
+	// scenariosLeavingProcesses are the scenarios which left processes
+	// behind in strict mode. Hooks cannot fail scenarios, so the test run
+	// fails instead.
+	scenariosLeavingProcesses []string
+)
+
+type leftoverProcess struct {
+	pid         int
+	commandLine string
+}
+
+// shellPids returns the pids of the host shell and the named shell sessions,
+// which are kept running between scenarios. The processes started by
+// scenarios are the ones in their process groups and sessions and below
+// them.
+func shellPids() map[int]bool {
+	pids := make(map[int]bool)
+	if shell.instance != nil {
+		pids[shell.instance.Process.Pid] = true
+	}
+	for _, session := range shellSessions {
+		if session.instance != nil {
+			pids[session.instance.Process.Pid] = true
+		}
+	}
+
+	return pids
+}
+
+func processList(processes []leftoverProcess) string {
+	var list []string
+	for _, process := range processes {
+		list = append(list, fmt.Sprintf("%d: %s", process.pid, process.commandLine))
+	}
+
+	return strings.Join(list, "\n")
+}
+
+// checkLeftoverProcesses kills the processes the scenario left behind and
+// logs them. In strict mode the scenario is recorded to fail the test run.
+func checkLeftoverProcesses(scenario string) {
+	leftovers := findLeftoverProcesses(shellPids())
+	if len(leftovers) == 0 {
+		return
+	}
+
+	killProcesses(leftovers)
+	message := fmt.Sprintf("%d processes were left behind by scenario '%s' and killed:\n%s",
+		len(leftovers), scenario, processList(leftovers))
+	util.LogMessage("info", message)
+	if strictProcesses {
+		fmt.Println(message)
+		scenariosLeavingProcesses = append(scenariosLeavingProcesses, scenario)
+	}
+}
+
+// leftoverProcessesStatus returns the exit status of the test run, which
+// fails if scenarios left processes behind in strict mode.
+func leftoverProcessesStatus(status int) int {
+	if len(scenariosLeavingProcesses) == 0 {
+		return status
+	}
+
+	fmt.Printf("%d scenarios left processes behind:\n%s\n",
+		len(scenariosLeavingProcesses), strings.Join(scenariosLeavingProcesses, "\n"))
+	if status == 0 {
+		return 1
+	}
+
+	return status
+}
+
+// KillLeftoverProcesses kills the processes started by the scenario which
+// are still running.
+func KillLeftoverProcesses() error {
+	leftovers := findLeftoverProcesses(shellPids())
+	if len(leftovers) > 0 {
+		util.LogMessage("info", fmt.Sprintf("killing processes left behind by the scenario:\n%s", processList(leftovers)))
+		killProcesses(leftovers)
+	}
+
+	return nil
+}
+
+// NoProcessesShouldBeLeft runs the cleanup actions and stops the background
+// processes of the scenario, then fails if any other process started by it
+// is still running. Those processes are killed.
+func NoProcessesShouldBeLeft() error {
+	RunCleanups()
+	StopBackgroundProcesses()
+
+	leftovers := findLeftoverProcesses(shellPids())
+	if len(leftovers) == 0 {
+		return nil
+	}
+	killProcesses(leftovers)
+
+	return fmt.Errorf("%d processes were left behind by the scenario and killed:\n%s", len(leftovers), processList(leftovers))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"syscall"
+	"time"
+)
+
+// findLeftoverProcesses returns the processes which are still running in
+// the process groups and sessions of the shells with the given pids or
+// below them, but the shells themselves. Processes which started sessions
+// of their own after being orphaned are not found.
+func findLeftoverProcesses(shells map[int]bool) []leftoverProcess {
+	found := make(map[int]bool)
+	for pid := range shells {
+		for _, descendant := range descendants(pid) {
+			found[descendant] = true
+		}
+	}
+	for _, pid := range processIDs() {
+		group, session, err := processGroupAndSession(pid)
+		if err == nil && (shells[group] || shells[session]) {
+			found[pid] = true
+		}
+	}
+
+	var leftovers []leftoverProcess
+	for pid := range found {
+		if shells[pid] {
+			continue
+		}
+
+		state, err := processState(pid)
+		if err != nil || state == "Z" {
+			continue
+		}
+		leftovers = append(leftovers, leftoverProcess{pid, processCommandLine(pid)})
+	}
+
+	return leftovers
+}
+
+// killProcesses kills the processes and waits for them to exit.
+func killProcesses(processes []leftoverProcess) {
+	for _, process := range processes {
+		syscall.Kill(process.pid, syscall.SIGKILL)
+	}
+
+	// the signals are delivered asynchronously
+	for _, process := range processes {
+		waitForProcessExit(process.pid, time.Second)
+	}
+}
+
+// waitForProcessExit waits until the process is gone or a zombie.
+func waitForProcessExit(pid int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		state, err := processState(pid)
+		if err != nil || state == "Z" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -29,7 +29,22 @@ import (
 //ParseFlags defines flags which are used by test suite.
 func ParseFlags() {
 	flag.StringVar(&testDir, "test-dir", "out", "Path to the directory in which to execute the tests")
-	flag.StringVar(&testWithShell, "test-shell", "", "Specifies shell to be used for the testing.")
+	flag.StringVar(&testWithShell, "test-shell", "", "Specifies shell to be used for the testing, one of bash, zsh, fish, tcsh, sh, dash, ksh, cmd and powershell.")
+	flag.StringVar(&testWithShells, "test-shells", "", "Comma separated list of shells, the features are run once with each of them.")
+	flag.StringVar(&exitCodesFile, "test-exit-codes", "", "Path to a JSON or YAML file mapping names to exit codes.")
+	flag.StringVar(&benchmarkBaseline, "test-benchmark-baseline", "", "Path to a JSON file with the benchmark results to compare to.")
+	flag.Float64Var(&benchmarkTolerance, "test-benchmark-tolerance", 0.2, "Fraction by which benchmark results may exceed the baseline.")
+	flag.BoolVar(&benchmarkUpdate, "test-benchmark-update", false, "Write the benchmark results to the baseline instead of comparing them.")
+	flag.BoolVar(&keepRunDir, "keep-run-dir", false, "Keep the files in the test run directory instead of cleaning it before each feature.")
+	flag.StringVar(&archiveSize, "test-archive-max-size", "100MB", "Maximum size of the test run directory archived for a failed scenario, 0 for no limit.")
+	flag.StringVar(&archiveInclude, "test-archive-include", "", "Comma separated globs of the files archived for a failed scenario, all files if empty.")
+	flag.StringVar(&archiveExclude, "test-archive-exclude", "", "Comma separated globs of the files and directories not archived for a failed scenario.")
+	flag.BoolVar(&testIsolated, "test-isolated", false, "Run every scenario in a directory and home directory of its own.")
+	flag.BoolVar(&recordPeakUsage, "test-resource-usage", false, "Record the peak memory and context switches of all commands, which run in a subshell then.")
+	flag.BoolVar(&strictProcesses, "test-strict-processes", false, "Fail the test run if scenarios leave processes running, which are killed in any case.")
+	flag.DurationVar(&commandTimeout, "test-command-timeout", 0, "Default time to wait for a command to finish, 0 waits forever.")
+	flag.BoolVar(&testShellTTY, "test-shell-tty", false, "Execute commands with a pseudo-terminal as stdin, stdout and stderr.")
+	flag.StringVar(&terminalSize, "test-shell-tty-size", "80x24", "Window size of the pseudo-terminal as COLUMNSxROWS.")
 
 	flag.StringVar(&GodogFormat, "godog.format", "pretty", "Sets which format godog will use")
 	flag.StringVar(&GodogTags, "godog.tags", "", "Tags for godog test")
@@ -43,6 +58,30 @@ func ParseFlags() {
 
 func PrepareForE2eTest() error {
 	var err error
+	// the working directory changes to the test run directory, so the
+	// paths given as flags are resolved before
+	for _, path := range []*string{&exitCodesFile, &benchmarkBaseline} {
+		if *path == "" {
+			continue
+		}
+		*path, err = filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if exitCodesFile != "" {
+		err = LoadExitCodes(exitCodesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	archiveMaxSize, err = parseSize(archiveSize)
+	if err != nil {
+		return fmt.Errorf("error parsing the archive size: %v", err)
+	}
+
 	if testDir == "" {
 		testDir, err = ioutil.TempDir("", "crc-e2e-test-")
 		if err != nil {
@@ -54,15 +93,23 @@ func PrepareForE2eTest() error {
 			return err
 		}
 
-		testDir = filepath.Join(wd, testDir)
+		if !filepath.IsAbs(testDir) {
+			testDir = filepath.Join(wd, testDir)
+		}
 		err = os.MkdirAll(testDir, os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("error creating directory for test run: %v", err)
 		}
 	}
 
-	testRunDir = filepath.Join(testDir, "test-run")
-	testResultsDir = filepath.Join(testDir, "test-results")
+	// every pass of a run with several shells gets its own directories,
+	// on the same level so that relative paths in features keep working
+	passSuffix := ""
+	if testShellPass != "" {
+		passSuffix = "-" + testShellPass
+	}
+	testRunDir = filepath.Join(testDir, "test-run"+passSuffix)
+	testResultsDir = filepath.Join(testDir, "test-results"+passSuffix)
 	testDefaultHome = filepath.Join(testRunDir, ".crc")
 
 	err = PrepareTestRunDir()
@@ -106,6 +153,10 @@ func PrepareTestRunDir() error {
 }
 
 func CleanTestRunDir() error {
+	if keepRunDir {
+		return nil
+	}
+
 	files, err := ioutil.ReadDir(testRunDir)
 	if err != nil {
 		return err
@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// statFields returns the fields of /proc/<pid>/stat following the command
+// name, starting with the state as the first one.
+func statFields(pid int) ([]string, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// the command name is in parentheses and may contain spaces
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return nil, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	return strings.Fields(string(stat[end+1:])), nil
+}
+
+// processIDs returns the pids of all processes.
+func processIDs() []int {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// descendants returns the pids of all processes below the process.
+func descendants(pid int) []int {
+	children := make(map[int][]int)
+	for _, child := range processIDs() {
+		parent, err := processParent(child)
+		if err != nil {
+			continue
+		}
+		children[parent] = append(children[parent], child)
+	}
+
+	var result []int
+	queue := children[pid]
+	for len(queue) > 0 {
+		result = append(result, queue[0])
+		queue = append(queue[1:], children[queue[0]]...)
+	}
+
+	return result
+}
+
+// processState returns the state of the process, like R, S or Z.
+func processState(pid int) (string, error) {
+	fields, err := statFields(pid)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	return fields[0], nil
+}
+
+// processParent returns the pid of the parent of the process.
+func processParent(pid int) (int, error) {
+	fields, err := statFields(pid)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	return strconv.Atoi(fields[1])
+}
+
+// processCommandLine returns the command line of the process.
+func processCommandLine(pid int) string {
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+}
+
+// processGroupAndSession returns the process group and session ids of the
+// process.
+func processGroupAndSession(pid int) (int, int, error) {
+	fields, err := statFields(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) < 4 {
+		return 0, 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	group, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	session, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return group, session, nil
+}
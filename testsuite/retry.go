@@ -0,0 +1,225 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/messages-go/v10"
+)
+
+const defaultRetryInterval = time.Second
+
+// retry calls attempt until it succeeds or timeout passes, with the time
+// left until then. The time waited between the attempts starts at interval
+// and is multiplied by backoff after every attempt. The error of the last
+// attempt is returned if none succeeded.
+func retry(timeout time.Duration, interval time.Duration, backoff float64, attempt func(remaining time.Duration) error) error {
+	deadline := time.Now().Add(timeout)
+	for attempts := 1; ; attempts++ {
+		err := attempt(time.Until(deadline))
+		if err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("did not succeed within %v after %d attempts, last failure: %v", timeout, attempts, err)
+		}
+
+		wait := interval
+		if wait > remaining {
+			wait = remaining
+		}
+		util.LogMessage("info", fmt.Sprintf("attempt %d failed, retrying in %v: %v", attempts, wait, err))
+		time.Sleep(wait)
+		interval = time.Duration(float64(interval) * backoff)
+	}
+}
+
+// attemptTimeout returns the time a command executed by an attempt may
+// take, which is the time left for retrying, or the command timeout if it
+// is shorter.
+func attemptTimeout(remaining time.Duration) time.Duration {
+	if remaining <= 0 {
+		// zero would wait for the command forever
+		remaining = time.Millisecond
+	}
+	if commandTimeout > 0 && commandTimeout < remaining {
+		return commandTimeout
+	}
+
+	return remaining
+}
+
+// parseRetryTiming parses the timeout, interval and optional backoff factor
+// of the retrying steps. The backoff factor must not make the interval
+// shrink.
+func parseRetryTiming(timeout string, interval string, backoff string) (time.Duration, time.Duration, float64, error) {
+	timeoutDuration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	intervalDuration, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	backoffFactor := 1.0
+	if backoff != "" {
+		backoffFactor, err = strconv.ParseFloat(backoff, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid backoff factor '%s': %v", backoff, err)
+		}
+		if backoffFactor < 1 {
+			return 0, 0, 0, fmt.Errorf("backoff factor '%s' is below 1", backoff)
+		}
+	}
+
+	return timeoutDuration, intervalDuration, backoffFactor, nil
+}
+
+// RetrySteps runs the steps of the docstring until all of them succeed in
+// one attempt or timeout passes. The commands the steps execute time out
+// when the time for retrying is up.
+func RetrySteps(timeout string, interval string, backoff string, steps *messages.PickleStepArgument_PickleDocString) error {
+	timeoutDuration, intervalDuration, backoffFactor, err := parseRetryTiming(timeout, interval, backoff)
+	if err != nil {
+		return err
+	}
+
+	stepTexts := parseSteps(steps.Content)
+	return retry(timeoutDuration, intervalDuration, backoffFactor, func(remaining time.Duration) error {
+		previousTimeout := commandTimeout
+		SetCommandTimeout(attemptTimeout(remaining))
+		defer SetCommandTimeout(previousTimeout)
+
+		return runSteps(stepTexts)
+	})
+}
+
+// ExecuteCommandUntil executes command every defaultRetryInterval until its
+// output matches expected, for at most the command timeout, or
+// defaultWaitTimeout if there is none.
+func ExecuteCommandUntil(command string, commandField string, expected string) error {
+	return executeCommandUntil(waitTimeout(), defaultRetryInterval, 1, command, commandField, expected)
+}
+
+// ExecuteCommandUntilWithin executes command until its output matches
+// expected like ExecuteCommandUntil, with the given timing.
+func ExecuteCommandUntilWithin(timeout string, interval string, backoff string, command string, commandField string, expected string) error {
+	timeoutDuration, intervalDuration, backoffFactor, err := parseRetryTiming(timeout, interval, backoff)
+	if err != nil {
+		return err
+	}
+
+	return executeCommandUntil(timeoutDuration, intervalDuration, backoffFactor, command, commandField, expected)
+}
+
+func executeCommandUntil(timeout time.Duration, interval time.Duration, backoff float64, command string, commandField string, expected string) error {
+	return retry(timeout, interval, backoff, func(remaining time.Duration) error {
+		err := shell.ExecuteCommand(command, attemptTimeout(remaining))
+		if err != nil {
+			return err
+		}
+
+		return CompareExpectedWithActualMatchesRegex(expected, shell.GetLastCmdOutput(commandField))
+	})
+}
+
+// holdFor calls check every interval until duration passes and fails as
+// soon as one of the checks fails.
+func holdFor(duration time.Duration, interval time.Duration, check func() error) error {
+	started := time.Now()
+	for polls := 1; ; polls++ {
+		err := check()
+		if err != nil {
+			return fmt.Errorf("condition broke at poll %d at %s, %v after polling started: %v",
+				polls, time.Now().Format("15:04:05.000"), time.Since(started).Round(time.Millisecond), err)
+		}
+
+		remaining := duration - time.Since(started)
+		if remaining <= 0 {
+			return nil
+		}
+		if remaining < interval {
+			time.Sleep(remaining)
+		} else {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// StepsHoldFor runs the steps of the docstring every interval for the
+// given duration and fails as soon as one of them fails.
+func StepsHoldFor(duration string, interval string, steps *messages.PickleStepArgument_PickleDocString) error {
+	durationValue, err := time.ParseDuration(duration)
+	if err != nil {
+		return err
+	}
+	intervalDuration, err := time.ParseDuration(interval)
+	if err != nil {
+		return err
+	}
+
+	stepTexts := parseSteps(steps.Content)
+	return holdFor(durationValue, intervalDuration, func() error {
+		return runSteps(stepTexts)
+	})
+}
+
+// CommandOutputHoldsFor executes command every interval for the given
+// duration and fails as soon as its output does not meet the condition.
+func CommandOutputHoldsFor(duration string, interval string, command string, commandField string, condition string, expected string) error {
+	durationValue, err := time.ParseDuration(duration)
+	if err != nil {
+		return err
+	}
+	intervalDuration, err := time.ParseDuration(interval)
+	if err != nil {
+		return err
+	}
+
+	var compare func(string, string) error
+	switch condition {
+	case "should contain", "contains":
+		compare = CompareExpectedWithActualContains
+	case "should not contain", "does not contain":
+		compare = CompareExpectedWithActualNotContains
+	case "should equal", "equals":
+		compare = CompareExpectedWithActualEquals
+	case "should not equal", "does not equal":
+		compare = CompareExpectedWithActualNotEquals
+	case "should match", "matches":
+		compare = CompareExpectedWithActualMatchesRegex
+	case "should not match", "does not match":
+		compare = CompareExpectedWithActualNotMatchesRegex
+	default:
+		return fmt.Errorf("unknown condition '%s'", condition)
+	}
+
+	return holdFor(durationValue, intervalDuration, func() error {
+		err := ExecuteCommand(command)
+		if err != nil {
+			return err
+		}
+
+		return compare(expected, shell.GetLastCmdOutput(commandField))
+	})
+}
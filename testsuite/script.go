@@ -0,0 +1,112 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/messages-go/v10"
+)
+
+func ExecuteScript(script *messages.PickleStepArgument_PickleDocString) error {
+	return shell.ExecuteScript(script.Content)
+}
+
+func ExecuteScriptSucceeds(script *messages.PickleStepArgument_PickleDocString) error {
+	err := shell.ExecuteScript(script.Content)
+	if err != nil {
+		return err
+	}
+
+	exitCode := shell.excbuf.String()
+	if exitCode == "0" {
+		return nil
+	}
+
+	return fmt.Errorf("script failed%s with exit code: %s\nCommand stdout: %s\nCommand stderr: %s",
+		shell.failedScriptLine, exitCode, shell.outbuf.String(), shell.errbuf.String())
+}
+
+// ExecuteScript writes script to a file and runs it in the shell instance
+// as one unit, like a script file. The script sees the state of the shell,
+// but does not change it, variables it sets are not kept. The exit code is
+// the one of the whole script. bash and zsh report the last line which
+// failed, which is added to the errors of the exitcode steps.
+func (shell *ShellInstance) ExecuteScript(script string) error {
+	if shell.scriptCommand == "" {
+		return fmt.Errorf("executing scripts is not supported in %s", shell.name)
+	}
+
+	file, err := ioutil.TempFile("", "clicumber-script-*"+shell.scriptExtension)
+	if err != nil {
+		return fmt.Errorf("error creating file for script: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(script + "\n" + shell.scriptEnd)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error writing script to '%s': %v", file.Name(), err)
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	failedLineFile := file.Name() + ".line"
+	defer os.Remove(failedLineFile)
+
+	lines := strings.Split(script, "\n")
+	for _, line := range lines {
+		util.LogMessage("script", line)
+	}
+
+	err = shell.ExecuteCommand(fmt.Sprintf(shell.scriptCommand, shell.quote(file.Name()), shell.quote(failedLineFile)), commandTimeout)
+	if err != nil {
+		return fmt.Errorf("script failed: %v", err)
+	}
+	if shell.excbuf.String() == "0" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(failedLineFile)
+	if err != nil {
+		return nil
+	}
+	failedLine, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err == nil && failedLine > 0 && failedLine <= len(lines) {
+		shell.failedScriptLine = fmt.Sprintf(" at line %d '%s'", failedLine, strings.TrimSpace(lines[failedLine-1]))
+		util.LogMessage("info", "script failed"+shell.failedScriptLine)
+	}
+
+	return nil
+}
+
+// withFailedScriptLine adds the line at which the last command, a script,
+// failed to err, if err is about its exit code.
+func withFailedScriptLine(commandField string, err error) error {
+	if err == nil || commandField != "exitcode" || shell.failedScriptLine == "" {
+		return err
+	}
+
+	return fmt.Errorf("%v\nScript failed%s", err, shell.failedScriptLine)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+// shellSessions holds the named shell instances used next to the host
+// shell. They are of the same type as the host shell and are started on
+// first use.
+var shellSessions = make(map[string]*ShellInstance)
+
+func getShellSession(name string) (*ShellInstance, error) {
+	session, exists := shellSessions[name]
+	if exists {
+		return session, nil
+	}
+	if shell.name == "" {
+		return nil, fmt.Errorf("shell instance is not started")
+	}
+
+	util.LogMessage("info", fmt.Sprintf("----- Starting shell session '%s' -----", name))
+	session = &ShellInstance{}
+	err := session.Start(shell.name)
+	if err != nil {
+		return nil, fmt.Errorf("error starting shell session '%s': %v", name, err)
+	}
+	shellSessions[name] = session
+
+	return session, nil
+}
+
+// lastSessionOutput returns the output of the last command executed in the
+// named shell session.
+func lastSessionOutput(name string, commandField string) (string, error) {
+	session, exists := shellSessions[name]
+	if !exists {
+		return "", fmt.Errorf("no command has been executed in shell '%s'", name)
+	}
+
+	return session.GetLastCmdOutput(commandField), nil
+}
+
+func ExecuteCommandInShell(name string, command string) error {
+	session, err := getShellSession(name)
+	if err != nil {
+		return err
+	}
+
+	return session.ExecuteCommand(command, commandTimeout)
+}
+
+func ExecuteCommandInShellSucceedsOrFails(name string, command string, expectedResult string) error {
+	session, err := getShellSession(name)
+	if err != nil {
+		return err
+	}
+
+	return session.executeCommandSucceedsOrFails(command, expectedResult)
+}
+
+func ShellReturnShouldContain(commandField string, name string, expected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualContains(expected, actual)
+}
+
+func ShellReturnShouldNotContain(commandField string, name string, notexpected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualNotContains(notexpected, actual)
+}
+
+func ShellReturnShouldEqual(commandField string, name string, expected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualEquals(expected, actual)
+}
+
+func ShellReturnShouldNotEqual(commandField string, name string, expected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualNotEquals(expected, actual)
+}
+
+func ShellReturnShouldMatch(commandField string, name string, expected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualMatchesRegex(expected, actual)
+}
+
+func ShellReturnShouldNotMatch(commandField string, name string, expected string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualNotMatchesRegex(expected, actual)
+}
+
+func ShellReturnShouldBeEmpty(commandField string, name string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualEquals("", actual)
+}
+
+func ShellReturnShouldNotBeEmpty(commandField string, name string) error {
+	actual, err := lastSessionOutput(name, commandField)
+	if err != nil {
+		return err
+	}
+
+	return CompareExpectedWithActualNotEquals("", actual)
+}
+
+// RestartExitedShellInstances restarts the host shell and the named shell
+// sessions whose process has exited.
+func RestartExitedShellInstances() error {
+	err := shell.RestartIfExited()
+	if err != nil {
+		return fmt.Errorf("error restarting %s instance: %v", shell.name, err)
+	}
+
+	for name, session := range shellSessions {
+		err = session.RestartIfExited()
+		if err != nil {
+			return fmt.Errorf("error restarting shell session '%s': %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// CloseShellSessions closes all named shell sessions.
+func CloseShellSessions() {
+	for name, session := range shellSessions {
+		util.LogMessage("info", fmt.Sprintf("----- Closing shell session '%s' -----", name))
+		session.Close()
+		delete(shellSessions, name)
+	}
+}
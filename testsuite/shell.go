@@ -22,9 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cucumber/messages-go/v10"
@@ -32,38 +35,199 @@ import (
 )
 
 const (
-	exitCodeIdentifier = "exitCodeOfLastCommandInShell="
-
-	bashExitCodeCheck       = "echo %v$?"
-	fishExitCodeCheck       = "echo %v$status"
-	tcshExitCodeCheck       = "echo %v$?"
-	zshExitCodeCheck        = "echo %v$?"
-	cmdExitCodeCheck        = "echo %v%%errorlevel%%"
-	powershellExitCodeCheck = "echo %v$lastexitcode"
+	commandStartIdentifier = "startOfCommandInShell"
+	exitCodeIdentifier     = "exitCodeOfLastCommandInShell"
+	commandEndIdentifier   = "endOfCommandInShell"
+
+	// Every command is framed by a start marker printed before it and end
+	// markers printed after it, on both stdout and stderr. The end markers
+	// are preceded by a newline so that they always start a line of their
+	// own, even if the output of the command is not terminated by one.
+	// The start frame gets the start marker, the end frame gets the marker
+	// followed by the exit code on stdout and the end marker on stderr.
+	bashStartFrame       = `echo %[1]s; echo %[1]s 1>&2`
+	bashEndFrame         = `__clicumber_ec=$?; printf '\n%[1]s=%%s\n' "$__clicumber_ec"; printf '\n%[2]s\n' 1>&2`
+	fishStartFrame       = `echo %[1]s; echo %[1]s 1>&2`
+	fishEndFrame         = `set __clicumber_ec $status; printf '\n%[1]s=%%s\n' $__clicumber_ec; printf '\n%[2]s\n' 1>&2`
+	tcshStartFrame       = `echo %[1]s; echo %[1]s > /dev/stderr`
+	tcshEndFrame         = `set __clicumber_ec = $status; printf '\n%[1]s=%%s\n' $__clicumber_ec; printf '\n%[2]s\n' > /dev/stderr`
+	shStartFrame         = `echo %[1]s; echo %[1]s 1>&2`
+	shEndFrame           = `__clicumber_ec=$?; printf '\n%[1]s=%%s\n' "$__clicumber_ec"; printf '\n%[2]s\n' 1>&2`
+	zshStartFrame        = `echo %[1]s; echo %[1]s 1>&2`
+	zshEndFrame          = `__clicumber_ec=$?; printf '\n%[1]s=%%s\n' "$__clicumber_ec"; printf '\n%[2]s\n' 1>&2`
+	cmdStartFrame        = `echo %[1]s& 1>&2 echo %[1]s`
+	cmdEndFrame          = `echo.& echo %[1]s=%%errorlevel%%& 1>&2 echo.& 1>&2 echo %[2]s`
+	powershellStartFrame = `[Console]::Out.WriteLine('%[1]s'); [Console]::Error.WriteLine('%[1]s')`
+	powershellEndFrame   = "$__clicumber_ec = $LASTEXITCODE; [Console]::Out.Write(\"`n%[1]s=$__clicumber_ec`n\"); [Console]::Error.Write(\"`n%[2]s`n\")"
+
+	// Commands executed in a terminal get the terminal as stdin, stdout and
+	// stderr, %[1]s is the command and %[2]s the path of the terminal. The
+	// terminal frames print the start and end markers into the terminal.
+	bashTerminalCommand = "{ %[1]s\n} < %[2]s > %[2]s 2>&1"
+	fishTerminalCommand = "begin; %[1]s\nend < %[2]s > %[2]s 2>&1"
+	shTerminalCommand   = "{ %[1]s\n} < %[2]s > %[2]s 2>&1"
+	tcshTerminalCommand = "( %[1]s ) < %[2]s >& %[2]s"
+	zshTerminalCommand  = "{ %[1]s\n} < %[2]s > %[2]s 2>&1"
+	terminalStartFrame  = `printf '%[1]s\n' > %[2]s`
+	terminalEndFrame    = `printf '\n%[1]s\n' > %[2]s`
+
+	// Commands with stdin read it from a file, %[1]s is the command and
+	// %[2]s the quoted path of the file.
+	bashStdinCommand       = "{ %[1]s\n} < %[2]s"
+	fishStdinCommand       = "begin; %[1]s\nend < %[2]s"
+	shStdinCommand         = "{ %[1]s\n} < %[2]s"
+	tcshStdinCommand       = "( %[1]s ) < %[2]s"
+	zshStdinCommand        = "{ %[1]s\n} < %[2]s"
+	cmdStdinCommand        = `%[1]s < "%[2]s"`
+	powershellStdinCommand = `Get-Content -Raw -LiteralPath %[2]s | %[1]s`
+
+	// Environment variables are set, unset and printed with these, %[1]s
+	// is the name of the variable and %[2]s the value quoted for the shell,
+	// for cmd the path of a file containing it. Printing a variable which
+	// is not set exits with a non-zero exit code.
+	posixSetEnvCommand        = `export %[1]s=%[2]s`
+	posixUnsetEnvCommand      = `unset %[1]s`
+	unixGetEnvCommand         = `printenv %[1]s`
+	fishSetEnvCommand         = `set -gx %[1]s %[2]s`
+	fishUnsetEnvCommand       = `set -e %[1]s`
+	tcshSetEnvCommand         = `setenv %[1]s %[2]s`
+	tcshUnsetEnvCommand       = `unsetenv %[1]s`
+	cmdSetEnvCommand          = `ver > nul & set /p %[1]s=<"%[2]s"`
+	cmdUnsetEnvCommand        = `set %[1]s=`
+	cmdGetEnvCommand          = `if defined %[1]s (ver > nul & for /f "tokens=1* delims==" %%i in ('set %[1]s') do if /i "%%i"=="%[1]s" echo(%%j) else (cmd /c exit 1)`
+	powershellSetEnvCommand   = `$Env:%[1]s = %[2]s`
+	powershellUnsetEnvCommand = `Remove-Item -LiteralPath Env:%[1]s -ErrorAction SilentlyContinue`
+	powershellGetEnvCommand   = `if (Test-Path -LiteralPath Env:%[1]s) { [Console]::Out.WriteLine($Env:%[1]s) } else { $global:LASTEXITCODE = 1 }`
+
+	// Scripts are written to a file which runs as one unit in a subshell,
+	// or a child shell for fish and cmd, so that it can neither change the
+	// state of the shell nor make it exit. %[1]s is the quoted path of the
+	// script. bash and zsh write the number of the last line of the script
+	// which failed to the file at the quoted path %[2]s, errTrapScriptEnd
+	// is appended to the script to remove the trap before it returns.
+	errTrapScriptCommand    = `( trap "echo \$LINENO > %[2]s" ERR; . %[1]s )`
+	errTrapScriptEnd        = `__clicumber_ec=$?; trap - ERR; return $__clicumber_ec`
+	posixScriptCommand      = `( . %[1]s )`
+	fishScriptCommand       = `fish %[1]s`
+	tcshScriptCommand       = `( source %[1]s )`
+	cmdScriptCommand        = `cmd /c "%[1]s"`
+	powershellScriptCommand = `& %[1]s`
+
+	// With the peak memory of commands recorded, they run in a subshell
+	// which executes the exit-usage helper once they finished, %[1]s is the
+	// command and %[2]s the helper command, which gets the exit code.
+	posixUsageCommand = "( %[1]s\n__clicumber_ec=$?; exec %[2]s $__clicumber_ec )"
+	tcshUsageCommand  = "( %[1]s; exec %[2]s $status )"
+
+	// The working directory is changed with these, %[1]s is the quoted path,
+	// for cmd the path of a file containing it.
+	unixChangeDirCommand       = `cd %[1]s`
+	cmdChangeDirCommand        = `ver > nul & for /f "usebackq delims=" %%i in ("%[1]s") do cd /d "%%i"`
+	powershellChangeDirCommand = `Set-Location -LiteralPath %[1]s`
 )
 
 var (
 	shell ShellInstance
+
+	// commandTimeout is the time ExecuteCommand waits for a command to
+	// finish, zero means waiting forever.
+	commandTimeout time.Duration
+
+	// testShellTTY makes ExecuteCommand attach all commands to a terminal
+	// of size terminalSize.
+	testShellTTY bool
+	terminalSize string
 )
 
 type ShellInstance struct {
-	startArgument    []string
-	name             string
-	checkExitCodeCmd string
+	startArgument []string
+	name          string
+	// commandArgument makes the shell execute a command given as the
+	// next argument
+	commandArgument string
+	startFrame      string
+	endFrame        string
+
+	// terminalCommand is empty for shells which cannot attach commands to
+	// a terminal
+	terminalCommand string
+	stdinCommand    string
+
+	setEnvCommand    string
+	unsetEnvCommand  string
+	getEnvCommand    string
+	changeDirCommand string
+
+	scriptCommand   string
+	scriptEnd       string
+	scriptExtension string
+
+	// usageCommand is empty for shells which cannot record the peak
+	// memory of commands
+	usageCommand string
 
 	instance *exec.Cmd
 	outbuf   bytes.Buffer
 	errbuf   bytes.Buffer
 	excbuf   bytes.Buffer
+	ttybuf   bytes.Buffer
+
+	// bufferLock guards outbuf, errbuf and ttybuf, which are filled by
+	// ScanPipe while a command is still running.
+	bufferLock sync.Mutex
 
 	outPipe io.ReadCloser
 	errPipe io.ReadCloser
 	inPipe  io.WriteCloser
 
-	outScanner *bufio.Scanner
-	errScanner *bufio.Scanner
+	outReader *bufio.Reader
+	errReader *bufio.Reader
 
+	// markerID makes the frame markers unique for each started shell
+	// process, the markers themselves are derived from it.
+	markerID        string
 	exitCodeChannel chan string
+	errDoneChannel  chan struct{}
+	// exitedChannel is closed once stdout and stderr of the shell process
+	// are closed, which means the shell has exited
+	exitedChannel chan struct{}
+	// readersStopped is closed when the shell process is killed, so that
+	// its readers stop storing output
+	readersStopped chan struct{}
+
+	terminal       *terminal
+	ttyDoneChannel chan struct{}
+	// controllingTerminal is set if terminal is the controlling terminal
+	// of the shell process, otherwise commands executed in the terminal
+	// get it as controlling terminal of a session of their own
+	controllingTerminal bool
+
+	// interactiveOffset is the position in ttybuf up to which the output
+	// of an interactive command has been matched already, secrets are
+	// masked in the log
+	interactiveOffset int
+	secrets           []string
+
+	// commandStarted is the time the last command was sent to the shell,
+	// lastDuration is the time it took to finish
+	commandStarted time.Time
+	lastDuration   time.Duration
+
+	// usageMonitor collects the resources used by the running command,
+	// lastUsage is nil if they are not known
+	usageMonitor *usageMonitor
+	lastUsage    *resourceUsage
+	// usageReport is the file the exit-usage helper writes the resources
+	// used by the running command to, if they are recorded
+	usageReport string
+
+	// failedScriptLine describes the line at which the last command, a
+	// script, failed, if it is known
+	failedScriptLine string
+
+	// internalCommand is set while a command the testsuite uses to manage
+	// the shell runs, its resource usage is not recorded
+	internalCommand bool
 }
 
 func (shell *ShellInstance) GetLastCmdOutput(stdType string) string {
@@ -84,55 +248,275 @@ func (shell *ShellInstance) GetLastCmdOutput(stdType string) string {
 	return returnValue
 }
 
-func (shell *ShellInstance) ScanPipe(scanner *bufio.Scanner, buffer *bytes.Buffer, stdType string) {
-	for scanner.Scan() {
-		str := scanner.Text()
-		util.LogMessage(stdType, str)
+func (shell *ShellInstance) startMarker() string {
+	return commandStartIdentifier + shell.markerID
+}
 
-		if strings.Contains(str, exitCodeIdentifier) && !strings.Contains(str, shell.checkExitCodeCmd) {
-			exitCode := strings.Split(str, "=")[1]
-			shell.exitCodeChannel <- exitCode
-		} else {
-			buffer.WriteString(str + "\n")
+func (shell *ShellInstance) exitCodeMarker() string {
+	return exitCodeIdentifier + shell.markerID
+}
+
+func (shell *ShellInstance) endMarker() string {
+	return commandEndIdentifier + shell.markerID
+}
+
+// ScanPipe reads the output of the shell and stores everything between the
+// start and end markers of a command in buffer. There is no limit on the
+// length of a line and the output is stored exactly as printed, including
+// bytes which are not valid UTF-8. Output which is not terminated by a
+// newline yet, like a prompt, is stored as soon as it is read. The exit
+// code found on stdout is sent to the exit code channel, reaching the end
+// marker on stderr or the terminal is signalled on the respective channel.
+func (shell *ShellInstance) ScanPipe(reader *bufio.Reader, buffer *bytes.Buffer, stdType string, frame scanFrame) {
+	exitCodeChannel, errDoneChannel, ttyDoneChannel, stopped := frame.exitCodeChannel, frame.errDoneChannel, frame.ttyDoneChannel, frame.stopped
+	startMarker, exitCodeMarker, endMarker := frame.startMarker, frame.exitCodeMarker+"=", frame.endMarker
+
+	// line holds the current line, of which the first stored bytes have
+	// been written to buffer already
+	var line []byte
+	var stored int
+	capturing := false
+
+	// an empty line is only logged once the next line is read, as it may
+	// be the newline of the frame in front of the end markers
+	emptyLinePending := false
+	logLine := func(str string) {
+		if emptyLinePending {
+			util.LogOutput(stdType, "")
+			emptyLinePending = false
+		}
+		if str == "" && capturing {
+			emptyLinePending = true
+			return
 		}
+		util.LogOutput(stdType, shell.maskSecrets(str))
 	}
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(chunk)
+		line = append(line, chunk[:n]...)
+
+		for {
+			index := bytes.IndexByte(line, '\n')
+			if index < 0 {
+				break
+			}
+			str := strings.TrimRight(string(line[:index]), "\r")
+
+			switch {
+			case stored > 0:
+				shell.storeOutput(buffer, line[stored:index+1], capturing, stopped)
+				logLine(str)
+			case str == startMarker:
+				capturing = true
+			case capturing && stdType == "stdout" && strings.HasPrefix(str, exitCodeMarker):
+				capturing = false
+				emptyLinePending = false
+				shell.trimFrameNewline(buffer)
+				select {
+				case exitCodeChannel <- strings.TrimPrefix(str, exitCodeMarker):
+				case <-stopped:
+				}
+			case capturing && stdType == "stderr" && str == endMarker:
+				capturing = false
+				emptyLinePending = false
+				shell.trimFrameNewline(buffer)
+				select {
+				case errDoneChannel <- struct{}{}:
+				case <-stopped:
+				}
+			case capturing && stdType == "tty" && str == endMarker:
+				capturing = false
+				emptyLinePending = false
+				shell.trimFrameNewline(buffer)
+				select {
+				case ttyDoneChannel <- struct{}{}:
+				case <-stopped:
+				}
+			default:
+				shell.storeOutput(buffer, line[:index+1], capturing, stopped)
+				logLine(str)
+			}
 
-	return
+			line = line[index+1:]
+			stored = 0
+		}
+
+		// an unterminated line can be stored right away, unless it may
+		// still turn into one of the markers
+		partial := strings.TrimRight(string(line), "\r")
+		if capturing && len(line) > stored && (stored > 0 || !isMarkerPrefix(partial, startMarker, exitCodeMarker, endMarker)) {
+			shell.storeOutput(buffer, line[stored:], capturing, stopped)
+			stored = len(line)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// scanFrame holds the channels and markers of the shell process a reader
+// reads from. They are passed to ScanPipe when the reader is started, as a
+// restarted shell gets new ones.
+type scanFrame struct {
+	exitCodeChannel chan string
+	errDoneChannel  chan struct{}
+	ttyDoneChannel  chan struct{}
+	stopped         <-chan struct{}
+
+	startMarker    string
+	exitCodeMarker string
+	endMarker      string
+}
+
+func (shell *ShellInstance) scanFrame() scanFrame {
+	return scanFrame{
+		exitCodeChannel: shell.exitCodeChannel,
+		errDoneChannel:  shell.errDoneChannel,
+		ttyDoneChannel:  shell.ttyDoneChannel,
+		stopped:         shell.readersStopped,
+		startMarker:     shell.startMarker(),
+		exitCodeMarker:  shell.exitCodeMarker(),
+		endMarker:       shell.endMarker(),
+	}
+}
+
+// storeOutput writes output to buffer, unless the reader belongs to a shell
+// process which has been replaced already.
+func (shell *ShellInstance) storeOutput(buffer *bytes.Buffer, output []byte, capturing bool, stopped <-chan struct{}) {
+	if !capturing {
+		return
+	}
+
+	shell.bufferLock.Lock()
+	defer shell.bufferLock.Unlock()
+	select {
+	case <-stopped:
+	default:
+		buffer.Write(output)
+	}
+}
+
+// isMarkerPrefix checks whether line can still become one of the markers
+// once the rest of it is read.
+func isMarkerPrefix(line string, markers ...string) bool {
+	for _, marker := range markers {
+		if strings.HasPrefix(marker, line) || strings.HasPrefix(line, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trimFrameNewline removes the newline printed in front of the end marker.
+func (shell *ShellInstance) trimFrameNewline(buffer *bytes.Buffer) {
+	shell.bufferLock.Lock()
+	defer shell.bufferLock.Unlock()
+
+	output := buffer.Bytes()
+	switch {
+	case bytes.HasSuffix(output, []byte("\r\n")):
+		buffer.Truncate(buffer.Len() - 2)
+	case bytes.HasSuffix(output, []byte("\n")):
+		buffer.Truncate(buffer.Len() - 1)
+	}
 }
 
 func (shell *ShellInstance) ConfigureTypeOfShell(shellName string) {
 	switch shellName {
 	case "bash":
 		shell.name = shellName
-		shell.checkExitCodeCmd = fmt.Sprintf(bashExitCodeCheck, exitCodeIdentifier)
+		shell.commandArgument = "-c"
+		shell.startFrame, shell.endFrame = bashStartFrame, bashEndFrame
+		shell.terminalCommand = bashTerminalCommand
+		shell.stdinCommand = bashStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = posixSetEnvCommand, posixUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+		shell.scriptCommand, shell.scriptEnd = errTrapScriptCommand, errTrapScriptEnd
+		shell.usageCommand = posixUsageCommand
+	case "fish":
+		shell.name = shellName
+		shell.commandArgument = "-c"
+		shell.startFrame, shell.endFrame = fishStartFrame, fishEndFrame
+		shell.terminalCommand = fishTerminalCommand
+		shell.stdinCommand = fishStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = fishSetEnvCommand, fishUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+		shell.scriptCommand = fishScriptCommand
+	case "sh", "dash", "ksh":
+		shell.name = shellName
+		shell.commandArgument = "-c"
+		shell.startFrame, shell.endFrame = shStartFrame, shEndFrame
+		shell.terminalCommand = shTerminalCommand
+		shell.stdinCommand = shStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = posixSetEnvCommand, posixUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+		shell.scriptCommand = posixScriptCommand
+		shell.usageCommand = posixUsageCommand
 	case "tcsh":
 		shell.name = shellName
-		shell.checkExitCodeCmd = fmt.Sprintf(tcshExitCodeCheck, exitCodeIdentifier)
+		shell.commandArgument = "-c"
+		shell.startFrame, shell.endFrame = tcshStartFrame, tcshEndFrame
+		shell.terminalCommand = tcshTerminalCommand
+		shell.stdinCommand = tcshStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = tcshSetEnvCommand, tcshUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+		shell.scriptCommand = tcshScriptCommand
+		shell.usageCommand = tcshUsageCommand
 	case "zsh":
 		shell.name = shellName
-		shell.checkExitCodeCmd = fmt.Sprintf(zshExitCodeCheck, exitCodeIdentifier)
+		shell.commandArgument = "-c"
+		shell.startFrame, shell.endFrame = zshStartFrame, zshEndFrame
+		shell.terminalCommand = zshTerminalCommand
+		shell.stdinCommand = zshStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = posixSetEnvCommand, posixUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+		shell.scriptCommand, shell.scriptEnd = errTrapScriptCommand, errTrapScriptEnd
+		shell.usageCommand = posixUsageCommand
 	case "cmd":
 		shell.name = shellName
-		shell.checkExitCodeCmd = fmt.Sprintf(cmdExitCodeCheck, exitCodeIdentifier)
+		shell.startArgument = []string{"/Q"}
+		shell.commandArgument = "/C"
+		shell.startFrame, shell.endFrame = cmdStartFrame, cmdEndFrame
+		shell.stdinCommand = cmdStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = cmdSetEnvCommand, cmdUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = cmdGetEnvCommand, cmdChangeDirCommand
+		shell.scriptCommand, shell.scriptExtension = cmdScriptCommand, ".cmd"
 	case "powershell":
 		shell.name = shellName
 		shell.startArgument = []string{"-Command", "-"}
-		shell.checkExitCodeCmd = fmt.Sprintf(powershellExitCodeCheck, exitCodeIdentifier)
-	case "fish":
-		fmt.Println("Fish shell is currently not supported by e2e tests. Default shell for the OS will be used.")
-		fallthrough
+		shell.commandArgument = "-Command"
+		shell.startFrame, shell.endFrame = powershellStartFrame, powershellEndFrame
+		shell.stdinCommand = powershellStdinCommand
+		shell.setEnvCommand, shell.unsetEnvCommand = powershellSetEnvCommand, powershellUnsetEnvCommand
+		shell.getEnvCommand, shell.changeDirCommand = powershellGetEnvCommand, powershellChangeDirCommand
+		shell.scriptCommand, shell.scriptExtension = powershellScriptCommand, ".ps1"
 	default:
-		if shell.name != "" {
-			fmt.Printf("Shell %v is not supported, will set the default shell for the OS to be used.\n", shell.name)
+		if shellName != "" {
+			fmt.Printf("Shell %v is not supported, will set the default shell for the OS to be used.\n", shellName)
 		}
 		switch runtime.GOOS {
 		case "darwin", "linux":
 			shell.name = "bash"
-			shell.checkExitCodeCmd = fmt.Sprintf(bashExitCodeCheck, exitCodeIdentifier)
+			shell.commandArgument = "-c"
+			shell.startFrame, shell.endFrame = bashStartFrame, bashEndFrame
+			shell.terminalCommand = bashTerminalCommand
+			shell.stdinCommand = bashStdinCommand
+			shell.setEnvCommand, shell.unsetEnvCommand = posixSetEnvCommand, posixUnsetEnvCommand
+			shell.getEnvCommand, shell.changeDirCommand = unixGetEnvCommand, unixChangeDirCommand
+			shell.scriptCommand, shell.scriptEnd = errTrapScriptCommand, errTrapScriptEnd
+			shell.usageCommand = posixUsageCommand
 		case "windows":
 			shell.name = "powershell"
 			shell.startArgument = []string{"-Command", "-"}
-			shell.checkExitCodeCmd = fmt.Sprintf(powershellExitCodeCheck, exitCodeIdentifier)
+			shell.commandArgument = "-Command"
+			shell.startFrame, shell.endFrame = powershellStartFrame, powershellEndFrame
+			shell.stdinCommand = powershellStdinCommand
+			shell.setEnvCommand, shell.unsetEnvCommand = powershellSetEnvCommand, powershellUnsetEnvCommand
+			shell.getEnvCommand, shell.changeDirCommand = powershellGetEnvCommand, powershellChangeDirCommand
+			shell.scriptCommand, shell.scriptExtension = powershellScriptCommand, ".ps1"
 		}
 	}
 
@@ -150,8 +534,17 @@ func (shell *ShellInstance) Start(shellName string) error {
 		shell.ConfigureTypeOfShell(shellName)
 	}
 	shell.exitCodeChannel = make(chan string)
+	shell.errDoneChannel = make(chan struct{})
+	shell.readersStopped = make(chan struct{})
+	shell.markerID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	// with -test-shell-tty all commands run in the terminal, which is the
+	// controlling terminal of the shell then, so that they can open
+	// /dev/tty, if the shell and the OS support terminals
+	shell.controllingTerminal = testShellTTY && shell.terminalCommand != "" && shell.openTerminal() == nil
 
 	shell.instance = exec.Command(shell.name, shell.startArgument...)
+	setShellProcessAttributes(shell.instance, shell.terminal)
 
 	shell.outPipe, err = shell.instance.StdoutPipe()
 	if err != nil {
@@ -168,11 +561,27 @@ func (shell *ShellInstance) Start(shellName string) error {
 		return err
 	}
 
-	shell.outScanner = bufio.NewScanner(shell.outPipe)
-	shell.errScanner = bufio.NewScanner(shell.errPipe)
-
-	go shell.ScanPipe(shell.outScanner, &shell.outbuf, "stdout")
-	go shell.ScanPipe(shell.errScanner, &shell.errbuf, "stderr")
+	shell.outReader = bufio.NewReader(shell.outPipe)
+	shell.errReader = bufio.NewReader(shell.errPipe)
+
+	frame := shell.scanFrame()
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go func() {
+		shell.ScanPipe(shell.outReader, &shell.outbuf, "stdout", frame)
+		readers.Done()
+	}()
+	go func() {
+		shell.ScanPipe(shell.errReader, &shell.errbuf, "stderr", frame)
+		readers.Done()
+	}()
+
+	exitedChannel := make(chan struct{})
+	shell.exitedChannel = exitedChannel
+	go func() {
+		readers.Wait()
+		close(exitedChannel)
+	}()
 
 	err = shell.instance.Start()
 	if err != nil {
@@ -188,6 +597,10 @@ func CloseHostShellInstance() error {
 }
 
 func (shell *ShellInstance) Close() error {
+	if shell.instance == nil {
+		return nil
+	}
+
 	closingCmd := "exit\n"
 	io.WriteString(shell.inPipe, closingCmd)
 	err := shell.instance.Wait()
@@ -196,39 +609,327 @@ func (shell *ShellInstance) Close() error {
 	}
 
 	shell.instance = nil
+	shell.closeTerminal()
 
 	return err
 }
 
+// Restart kills the shell process together with any command still running
+// in it and starts a new instance of the same shell.
+func (shell *ShellInstance) Restart() error {
+	if shell.readersStopped != nil {
+		close(shell.readersStopped)
+		shell.readersStopped = nil
+	}
+	if shell.instance != nil {
+		err := killShellProcess(shell.instance)
+		if err != nil {
+			fmt.Println("error killing shell instance:", err)
+		}
+		shell.instance.Wait()
+		shell.instance = nil
+	}
+	shell.closeTerminal()
+
+	util.LogMessage("info", fmt.Sprintf("----- Restarting %s instance -----", shell.name))
+
+	return shell.Start(shell.name)
+}
+
+// RestartIfExited starts a new instance of the shell if the shell process
+// has exited.
+func (shell *ShellInstance) RestartIfExited() error {
+	if shell.name == "" {
+		return nil
+	}
+	if shell.instance != nil {
+		select {
+		case <-shell.exitedChannel:
+			shell.instance.Wait()
+			shell.instance = nil
+		default:
+			return nil
+		}
+	}
+
+	return shell.Restart()
+}
+
+func RestartHostShellInstance() error {
+	return shell.Restart()
+}
+
+// exited collects the exit status of the shell process after it exited
+// while executing command and returns an error describing it together with
+// the output of the command.
+func (shell *ShellInstance) exited(command string) error {
+	shell.bufferLock.Lock()
+	stdout, stderr := shell.outbuf.String()+shell.ttybuf.String(), shell.errbuf.String()
+	shell.bufferLock.Unlock()
+	stdout, stderr = shell.maskSecrets(stdout), shell.maskSecrets(stderr)
+
+	shell.instance.Wait()
+	exitCode := processExitCode(shell.instance.ProcessState)
+	shell.instance = nil
+	shell.closeTerminal()
+
+	util.LogMessage("info", fmt.Sprintf("%s instance exited with exit code %d", shell.name, exitCode))
+	return fmt.Errorf("%s instance exited with exit code %d while executing command '%s'\nCommand stdout: %s\nCommand stderr: %s", shell.name, exitCode, command, stdout, stderr)
+}
+
+// SetCommandTimeout sets the default time ExecuteCommand waits for a command
+// to finish. Zero disables the timeout.
+func SetCommandTimeout(timeout time.Duration) {
+	commandTimeout = timeout
+}
+
 func ExecuteCommand(command string) error {
+	return shell.ExecuteCommand(command, commandTimeout)
+}
+
+func ExecuteCommandInTerminal(command string) error {
+	return shell.executeCommand(command, commandTimeout, true)
+}
+
+func ExecuteCommandWithTimeout(command string, timeout string) error {
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return err
+	}
+
+	return shell.ExecuteCommand(command, duration)
+}
+
+// ExecuteCommandTimesOut fails unless command is still running after
+// timeout. The shell is restarted, like for any command which times out.
+func ExecuteCommandTimesOut(command string, timeout string) error {
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return err
+	}
+
+	err = shell.ExecuteCommand(command, duration)
+	if _, timedOut := err.(*commandTimeoutError); timedOut {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("command '%s' finished within %v with exit code %s", command, duration, shell.excbuf.String())
+}
+
+// commandTimeoutError is returned for a command which did not finish in time
+// after the shell has been restarted.
+type commandTimeoutError struct {
+	message string
+}
+
+func (err *commandTimeoutError) Error() string {
+	return err.message
+}
+
+// ExecuteCommand runs command in the shell instance and waits until it
+// finishes. If timeout is not zero and the command does not finish in time,
+// the shell instance is restarted and an error containing the output
+// captured so far is returned.
+func (shell *ShellInstance) ExecuteCommand(command string, timeout time.Duration) error {
+	return shell.executeCommand(command, timeout, testShellTTY)
+}
+
+// executeCommand runs command like ExecuteCommand. If inTerminal is set,
+// the command is attached to a terminal and everything it prints is
+// stored as stdout.
+func (shell *ShellInstance) executeCommand(command string, timeout time.Duration, inTerminal bool) error {
+	err := shell.startCommand(command, inTerminal)
+	if err != nil {
+		return err
+	}
+
+	return shell.waitForCommand(command, timeout, inTerminal)
+}
+
+// startCommand sends command to the shell instance without waiting for it
+// to finish.
+func (shell *ShellInstance) startCommand(command string, inTerminal bool) error {
 	if shell.instance == nil {
 		return errors.New("shell instance is not started")
 	}
+	select {
+	case <-shell.exitedChannel:
+		return shell.exited(command)
+	default:
+	}
 
+	shell.bufferLock.Lock()
 	shell.outbuf.Reset()
 	shell.errbuf.Reset()
+	shell.ttybuf.Reset()
+	shell.bufferLock.Unlock()
 	shell.excbuf.Reset()
 
 	util.LogMessage(shell.name, command)
 
-	_, err := io.WriteString(shell.inPipe, command+"\n")
+	if !shell.internalCommand {
+		shell.failedScriptLine = ""
+	}
+	shell.lastUsage = nil
+	shell.usageMonitor = startUsageMonitor(shell.instance.Process.Pid)
+	shell.usageReport = ""
+	if recordingPeakUsage() && shell.usageCommand != "" && !shell.internalCommand {
+		var err error
+		command, err = shell.recordUsageOf(command)
+		if err != nil {
+			return err
+		}
+	}
+
+	startFrame := fmt.Sprintf(shell.startFrame, shell.startMarker())
+	endFrame := fmt.Sprintf(shell.endFrame, shell.exitCodeMarker(), shell.endMarker())
+	if inTerminal {
+		err := shell.openTerminal()
+		if err != nil {
+			return err
+		}
+
+		// without -test-shell-tty the shell has no controlling terminal,
+		// so that only commands executed in the terminal can open /dev/tty
+		if !shell.controllingTerminal {
+			command, err = shell.helperCommand(terminalHelper, shell.name, shell.commandArgument, command)
+			if err != nil {
+				return err
+			}
+		}
+
+		startFrame += "\n" + fmt.Sprintf(terminalStartFrame, shell.startMarker(), shell.terminal.path)
+		command = fmt.Sprintf(shell.terminalCommand, command, shell.terminal.path)
+		endFrame += "\n" + fmt.Sprintf(terminalEndFrame, shell.endMarker(), shell.terminal.path)
+	}
+
+	shell.commandStarted = time.Now()
+	_, err := io.WriteString(shell.inPipe, startFrame+"\n"+command+"\n"+endFrame+"\n")
+
+	return err
+}
+
+// waitForCommand waits until the command started by startCommand finishes
+// and stores its exit code. If timeout is not zero and the command does
+// not finish in time, the shell instance is restarted.
+func (shell *ShellInstance) waitForCommand(command string, timeout time.Duration, inTerminal bool) error {
+	monitor, report := shell.usageMonitor, shell.usageReport
+	shell.usageMonitor, shell.usageReport = nil, ""
+	defer monitor.Stop()
+	if report != "" {
+		defer os.Remove(report)
+	}
+
+	var timeoutChannel <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChannel = timer.C
+	}
+
+	for exitCodeReceived, stderrDone, ttyDone := false, false, !inTerminal; !exitCodeReceived || !stderrDone || !ttyDone; {
+		select {
+		case exitCode := <-shell.exitCodeChannel:
+			shell.excbuf.WriteString(exitCode)
+			exitCodeReceived = true
+		case <-shell.errDoneChannel:
+			stderrDone = true
+		case <-shell.ttyDoneChannel:
+			ttyDone = true
+		case <-shell.exitedChannel:
+			return shell.exited(command)
+		case <-timeoutChannel:
+			shell.bufferLock.Lock()
+			stdout, stderr := shell.outbuf.String()+shell.ttybuf.String(), shell.errbuf.String()
+			shell.bufferLock.Unlock()
+			stdout, stderr = shell.maskSecrets(stdout), shell.maskSecrets(stderr)
+
+			util.LogMessage("info", fmt.Sprintf("command '%s' timed out after %v", command, timeout))
+			restartErr := shell.Restart()
+			if restartErr != nil {
+				return fmt.Errorf("command '%s' did not finish within %v, restarting the shell failed: %v\nCommand stdout: %s\nCommand stderr: %s", command, timeout, restartErr, stdout, stderr)
+			}
+
+			return &commandTimeoutError{fmt.Sprintf("command '%s' did not finish within %v\nCommand stdout: %s\nCommand stderr: %s", command, timeout, stdout, stderr)}
+		}
+	}
+
+	shell.lastDuration = time.Since(shell.commandStarted)
+	util.LogMessage("info", fmt.Sprintf("command finished in %v", shell.lastDuration))
+	if !shell.internalCommand {
+		usage := monitor.Stop()
+		if usage != nil && report != "" {
+			usage.addReport(report)
+		}
+		shell.recordUsage(command, usage)
+	}
+
+	if inTerminal {
+		shell.bufferLock.Lock()
+		shell.outbuf.Write(shell.ttybuf.Bytes())
+		shell.bufferLock.Unlock()
+	}
+
+	return nil
+}
+
+// recordUsageOf returns command run in a subshell which records its peak
+// memory and context switches in a new usage report.
+func (shell *ShellInstance) recordUsageOf(command string) (string, error) {
+	report, err := newUsageReport()
 	if err != nil {
-		return err
+		return "", err
+	}
+	helper, err := shell.helperCommand(exitUsageHelper, report)
+	if err != nil {
+		os.Remove(report)
+		return "", err
+	}
+
+	shell.usageReport = report
+	return fmt.Sprintf(shell.usageCommand, command, helper), nil
+}
+
+// openTerminal opens the terminal commands of the shell instance are
+// attached to, unless it is open already.
+func (shell *ShellInstance) openTerminal() error {
+	if shell.terminal != nil {
+		return nil
+	}
+	if shell.terminalCommand == "" {
+		return fmt.Errorf("executing commands in a terminal is not supported for %s", shell.name)
 	}
 
-	_, err = shell.inPipe.Write([]byte(shell.checkExitCodeCmd + "\n"))
+	terminal, err := openTerminal(terminalSize)
 	if err != nil {
-		return err
+		return fmt.Errorf("error opening terminal: %v", err)
 	}
 
-	exitCode := <-shell.exitCodeChannel
-	shell.excbuf.WriteString(exitCode)
+	shell.terminal = terminal
+	shell.ttyDoneChannel = make(chan struct{})
+	go shell.ScanPipe(bufio.NewReader(terminal.master), &shell.ttybuf, "tty", shell.scanFrame())
 
-	return err
+	return nil
+}
+
+func (shell *ShellInstance) closeTerminal() {
+	if shell.terminal == nil {
+		return
+	}
+
+	shell.terminal.Close()
+	shell.terminal = nil
 }
 
 func ExecuteCommandSucceedsOrFails(command string, expectedResult string) error {
-	err := ExecuteCommand(command)
+	return shell.executeCommandSucceedsOrFails(command, expectedResult)
+}
+
+func (shell *ShellInstance) executeCommandSucceedsOrFails(command string, expectedResult string) error {
+	err := shell.ExecuteCommand(command, commandTimeout)
 	if err != nil {
 		return err
 	}
@@ -275,7 +976,7 @@ func ExecuteStdoutLineByLine() error {
 	stdout := shell.GetLastCmdOutput("stdout")
 	commandArray := strings.Split(stdout, "\n")
 	for index := range commandArray {
-		if !strings.Contains(commandArray[index], exitCodeIdentifier) {
+		if strings.TrimSpace(commandArray[index]) != "" {
 			err = ExecuteCommand(commandArray[index])
 		}
 	}
@@ -284,59 +985,59 @@ func ExecuteStdoutLineByLine() error {
 }
 
 func CommandReturnShouldContain(commandField string, expected string) error {
-	return CompareExpectedWithActualContains(expected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualContains(expected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldContainContent(commandField string, expected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualContains(expected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualContains(expected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotContain(commandField string, notexpected string) error {
-	return CompareExpectedWithActualNotContains(notexpected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotContains(notexpected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotContainContent(commandField string, notexpected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualNotContains(notexpected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotContains(notexpected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldBeEmpty(commandField string) error {
-	return CompareExpectedWithActualEquals("", shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualEquals("", shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotBeEmpty(commandField string) error {
-	return CompareExpectedWithActualNotEquals("", shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotEquals("", shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldEqual(commandField string, expected string) error {
-	return CompareExpectedWithActualEquals(expected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualEquals(expected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldEqualContent(commandField string, expected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualEquals(expected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualEquals(expected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotEqual(commandField string, expected string) error {
-	return CompareExpectedWithActualNotEquals(expected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotEquals(expected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotEqualContent(commandField string, expected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualNotEquals(expected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotEquals(expected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldMatch(commandField string, expected string) error {
-	return CompareExpectedWithActualMatchesRegex(expected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualMatchesRegex(expected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldMatchContent(commandField string, expected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualMatchesRegex(expected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualMatchesRegex(expected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotMatch(commandField string, expected string) error {
-	return CompareExpectedWithActualNotMatchesRegex(expected, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotMatchesRegex(expected, shell.GetLastCmdOutput(commandField)))
 }
 
 func CommandReturnShouldNotMatchContent(commandField string, expected *messages.PickleStepArgument_PickleDocString) error {
-	return CompareExpectedWithActualNotMatchesRegex(expected.Content, shell.GetLastCmdOutput(commandField))
+	return withFailedScriptLine(commandField, CompareExpectedWithActualNotMatchesRegex(expected.Content, shell.GetLastCmdOutput(commandField)))
 }
 
 func ShouldBeInValidFormat(commandField string, format string) error {
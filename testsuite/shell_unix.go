@@ -0,0 +1,76 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// setShellProcessAttributes puts the shell into its own process group, so
+// that the commands it runs can be killed together with it. With a terminal
+// the shell leads a session of its own with the terminal as its controlling
+// terminal, which is passed on as file descriptor 3.
+func setShellProcessAttributes(cmd *exec.Cmd, terminal *terminal) {
+	if terminal == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		return
+	}
+
+	cmd.ExtraFiles = []*os.File{terminal.slave}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 3}
+}
+
+func killShellProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// signalProcess sends the named signal to the process group of cmd.
+func signalProcess(cmd *exec.Cmd, name string) error {
+	signal, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal: %s", name)
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, signal)
+}
+
+// processExitCode returns the exit code of a finished process, following the
+// shell convention of 128+n for processes terminated by signal n.
+func processExitCode(state *os.ProcessState) int {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return state.ExitCode()
+}
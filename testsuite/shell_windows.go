@@ -0,0 +1,42 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func setShellProcessAttributes(cmd *exec.Cmd, terminal *terminal) {
+}
+
+func killShellProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func signalProcess(cmd *exec.Cmd, name string) error {
+	if name != "SIGKILL" {
+		return fmt.Errorf("unsupported signal on windows: %s", name)
+	}
+
+	return cmd.Process.Kill()
+}
+
+func processExitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
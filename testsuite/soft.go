@@ -0,0 +1,45 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/messages-go/v10"
+)
+
+// SoftAssertions runs all steps of the docstring, also the ones following
+// a failed step, and reports the failures of all of them together.
+func SoftAssertions(steps *messages.PickleStepArgument_PickleDocString) error {
+	var failures []string
+	stepTexts := parseSteps(steps.Content)
+	for _, step := range stepTexts {
+		err := runStep(step)
+		if err != nil {
+			util.LogMessage("info", fmt.Sprintf("soft assertion failed: %v", err))
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d soft assertions failed:\n%s", len(failures), len(stepTexts), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cucumber/messages-go/v10"
+)
+
+func ExecuteCommandWithStdin(command string, stdin *messages.PickleStepArgument_PickleDocString) error {
+	content := stdin.Content
+	if content != "" {
+		content += "\n"
+	}
+
+	return shell.executeCommandWithStdinContent(command, content)
+}
+
+func ExecuteCommandWithStdinFromFile(command string, path string) error {
+	return shell.executeCommandWithStdinFile(command, path)
+}
+
+// ExecuteCommandWithPreviousStdout feeds the stdout of the previous command,
+// including its trailing newline, to command.
+func ExecuteCommandWithPreviousStdout(command string) error {
+	shell.bufferLock.Lock()
+	stdout := shell.outbuf.String()
+	shell.bufferLock.Unlock()
+
+	return shell.executeCommandWithStdinContent(command, stdout)
+}
+
+// executeCommandWithStdinContent writes content to a temporary file and
+// executes command with the file as its stdin.
+func (shell *ShellInstance) executeCommandWithStdinContent(command string, content string) error {
+	file, err := ioutil.TempFile("", "clicumber-stdin-")
+	if err != nil {
+		return fmt.Errorf("error creating file for stdin: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(content)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error writing stdin to '%s': %v", file.Name(), err)
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return shell.executeCommandWithStdinFile(command, file.Name())
+}
+
+// executeCommandWithStdinFile executes command with its stdin redirected
+// from the file at path, which is resolved by the shell.
+func (shell *ShellInstance) executeCommandWithStdinFile(command string, path string) error {
+	if shell.stdinCommand == "" {
+		return fmt.Errorf("redirecting stdin is not supported in %s", shell.name)
+	}
+
+	return shell.ExecuteCommand(fmt.Sprintf(shell.stdinCommand, command, shell.quote(path)), commandTimeout)
+}
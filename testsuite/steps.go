@@ -0,0 +1,250 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/code-ready/clicumber/util"
+	"github.com/cucumber/godog"
+	"github.com/cucumber/messages-go/v10"
+)
+
+// stepDefinition is a step registered by Step, which can be run by the
+// steps running other steps.
+type stepDefinition struct {
+	expr    *regexp.Regexp
+	handler reflect.Value
+}
+
+var (
+	stepDefinitions []*stepDefinition
+
+	stepKeywordRegex = regexp.MustCompile(`^(?:Given|When|Then|And|But|\*)\s+`)
+)
+
+// nestedDocStringDelimiter encloses the docstrings of steps in a docstring.
+const nestedDocStringDelimiter = "```"
+
+// Step registers stepFunc for expr with the suite like godog.Suite.Step.
+// The step can also be used by steps which run other steps, like the
+// retrying ones, which do not know the steps registered with
+// godog.Suite.Step directly.
+func Step(s *godog.Suite, expr string, stepFunc interface{}) {
+	s.Step(expr, stepFunc)
+
+	definition := &stepDefinition{regexp.MustCompile(expr), reflect.ValueOf(stepFunc)}
+	for index, existing := range stepDefinitions {
+		if existing.expr.String() == expr {
+			stepDefinitions[index] = definition
+			return
+		}
+	}
+	stepDefinitions = append(stepDefinitions, definition)
+}
+
+// nestedStep is a step of a docstring, with the docstring of its own given
+// by the lines between ``` delimiters following it.
+type nestedStep struct {
+	text      string
+	docString *messages.PickleStepArgument_PickleDocString
+}
+
+// parseSteps returns the steps of a docstring, one per line, without their
+// keywords. Empty lines and comments are skipped.
+func parseSteps(content string) []nestedStep {
+	var steps []nestedStep
+	var docString []string
+	indent := -1
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if indent >= 0 {
+			if trimmed == nestedDocStringDelimiter {
+				steps[len(steps)-1].docString = &messages.PickleStepArgument_PickleDocString{
+					Content: strings.Join(docString, "\n"),
+				}
+				docString = nil
+				indent = -1
+				continue
+			}
+			// the indentation of the delimiter is removed like gherkin does
+			for column := 0; column < indent && strings.HasPrefix(line, " "); column++ {
+				line = line[1:]
+			}
+			docString = append(docString, line)
+			continue
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == nestedDocStringDelimiter && len(steps) > 0 {
+			indent = len(line) - len(strings.TrimLeft(line, " "))
+			continue
+		}
+		steps = append(steps, nestedStep{text: stepKeywordRegex.ReplaceAllString(trimmed, "")})
+	}
+
+	return steps
+}
+
+// runSteps runs the steps one after another and stops at the first one
+// which fails.
+func runSteps(steps []nestedStep) error {
+	for _, step := range steps {
+		err := runStep(step)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StepsFailWith runs the steps of the docstring and succeeds if one of them
+// fails with an error containing expected.
+func StepsFailWith(expected string, steps *messages.PickleStepArgument_PickleDocString) error {
+	return stepsFail(steps, expected, func(err error) bool {
+		return strings.Contains(err.Error(), expected)
+	})
+}
+
+// StepsFailWithErrorMatching runs the steps of the docstring and succeeds
+// if one of them fails with an error matching the regular expression
+// expected.
+func StepsFailWithErrorMatching(expected string, steps *messages.PickleStepArgument_PickleDocString) error {
+	regex, err := regexp.Compile(expected)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression '%s': %v", expected, err)
+	}
+
+	return stepsFail(steps, expected, func(err error) bool {
+		return regex.MatchString(err.Error())
+	})
+}
+
+func stepsFail(steps *messages.PickleStepArgument_PickleDocString, expected string, expectedError func(error) bool) error {
+	err := runSteps(parseSteps(steps.Content))
+	if err == nil {
+		return fmt.Errorf("steps succeeded, expected them to fail with '%s'", expected)
+	}
+	if !expectedError(err) {
+		return fmt.Errorf("steps failed with '%v', expected '%s'", err, expected)
+	}
+	util.LogMessage("info", fmt.Sprintf("steps failed as expected: %v", err))
+
+	return nil
+}
+
+// runStep runs the first step registered by Step which matches the text of
+// step, after replacing the scenario variables in it.
+func runStep(step nestedStep) error {
+	text := util.ProcessScenarioVariables(step.text)
+	for _, definition := range stepDefinitions {
+		match := definition.expr.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+
+		util.LogMessage("step", text)
+		err := definition.run(match[1:], step.docString)
+		if err != nil {
+			return fmt.Errorf("step '%s' failed: %v", text, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no step registered with testsuite.Step matches '%s'", text)
+}
+
+// run calls the handler with the matched arguments converted to the types
+// of its parameters, like godog does. The docstring, if any, is passed as
+// the last argument.
+func (definition *stepDefinition) run(args []string, docString *messages.PickleStepArgument_PickleDocString) error {
+	handlerType := definition.handler.Type()
+	params := handlerType.NumIn()
+	if docString != nil {
+		if params == 0 || handlerType.In(params-1) != reflect.TypeOf(docString) {
+			return fmt.Errorf("the step does not take a docstring")
+		}
+		params--
+	}
+	if len(args) < params {
+		return fmt.Errorf("func expects %d arguments, which is more than %d matched from step", params, len(args))
+	}
+
+	var values []reflect.Value
+	for index := 0; index < params; index++ {
+		param := handlerType.In(index)
+		value, err := convertStepArgument(args[index], param)
+		if err != nil {
+			return fmt.Errorf("cannot convert argument %d: '%s' to %v: %v", index, args[index], param, err)
+		}
+		values = append(values, value)
+	}
+	if docString != nil {
+		values = append(values, reflect.ValueOf(docString))
+	}
+
+	result := definition.handler.Call(values)[0].Interface()
+	switch result := result.(type) {
+	case error:
+		return result
+	case godog.Steps:
+		var steps []nestedStep
+		for _, text := range result {
+			steps = append(steps, nestedStep{text: text})
+		}
+		return runSteps(steps)
+	}
+
+	return nil
+}
+
+func convertStepArgument(arg string, param reflect.Type) (reflect.Value, error) {
+	value := reflect.New(param).Elem()
+	switch param.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(arg, 10, param.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetInt(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(arg, param.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetFloat(parsed)
+	case reflect.String:
+		value.SetString(arg)
+	case reflect.Slice:
+		if param.Elem().Kind() != reflect.Uint8 {
+			return value, fmt.Errorf("unsupported type")
+		}
+		value.SetBytes([]byte(arg))
+	default:
+		return value, fmt.Errorf("the step needs a docstring or table, which is not given")
+	}
+
+	return value, nil
+}
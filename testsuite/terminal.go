@@ -0,0 +1,58 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// terminal is a pseudo-terminal which commands executed by a shell instance
+// can be attached to, so that they see a TTY as stdin, stdout and stderr.
+type terminal struct {
+	master *os.File
+	// slave is kept open, so that reading from master does not fail while
+	// no command is attached to the terminal
+	slave *os.File
+	path  string
+}
+
+func (terminal *terminal) Close() error {
+	terminal.slave.Close()
+	return terminal.master.Close()
+}
+
+// parseTerminalSize parses window size given as COLUMNSxROWS, e.g. 80x24.
+func parseTerminalSize(size string) (uint16, uint16, error) {
+	split := strings.Split(size, "x")
+	if len(split) != 2 {
+		return 0, 0, fmt.Errorf("terminal size '%s' is not in format COLUMNSxROWS", size)
+	}
+
+	columns, err := strconv.ParseUint(split[0], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("number of columns in terminal size '%s' is not valid: %v", size, err)
+	}
+	rows, err := strconv.ParseUint(split[1], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("number of rows in terminal size '%s' is not valid: %v", size, err)
+	}
+
+	return uint16(columns), uint16(rows), nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	getTermiosRequest = syscall.TIOCGETA
+	setTermiosRequest = syscall.TIOCSETA
+)
+
+func openPTY() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, request := range []uintptr{syscall.TIOCPTYGRANT, syscall.TIOCPTYUNLK} {
+		err = ioctl(master, request, nil)
+		if err != nil {
+			master.Close()
+			return nil, "", err
+		}
+	}
+
+	name := make([]byte, 128)
+	err = ioctl(master, syscall.TIOCPTYGNAME, unsafe.Pointer(&name[0]))
+	if err != nil {
+		master.Close()
+		return nil, "", err
+	}
+
+	return master, string(name[:bytes.IndexByte(name, 0)]), nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func openTerminal(size string) (*terminal, error) {
+	return nil, fmt.Errorf("executing commands in a terminal is not supported on %s", runtime.GOOS)
+}
+
+func runInTerminal(args []string) error {
+	return fmt.Errorf("executing commands in a terminal is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,123 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+type windowSize struct {
+	rows    uint16
+	columns uint16
+	xpixel  uint16
+	ypixel  uint16
+}
+
+func openTerminal(size string) (*terminal, error) {
+	columns, rows, err := parseTerminalSize(size)
+	if err != nil {
+		return nil, err
+	}
+
+	master, path, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	err = configureTerminal(slave, columns, rows)
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+
+	return &terminal{master: master, slave: slave, path: path}, nil
+}
+
+func configureTerminal(file *os.File, columns uint16, rows uint16) error {
+	var attributes syscall.Termios
+	err := ioctl(file, getTermiosRequest, unsafe.Pointer(&attributes))
+	if err != nil {
+		return err
+	}
+
+	// keep "\n" line endings in the output, as it would be on a pipe
+	attributes.Oflag &^= syscall.ONLCR
+	err = ioctl(file, setTermiosRequest, unsafe.Pointer(&attributes))
+	if err != nil {
+		return err
+	}
+
+	size := windowSize{rows: rows, columns: columns}
+	return ioctl(file, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+}
+
+func ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// runInTerminal executes the program given by args in a session of its own,
+// with the terminal it gets as stdin as its controlling terminal.
+func runInTerminal(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no program to run in the terminal")
+	}
+	program, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = syscall.Setsid()
+	if err != nil {
+		return err
+	}
+	err = ioctl(os.Stdin, syscall.TIOCSCTTY, nil)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(program, args, os.Environ())
+}
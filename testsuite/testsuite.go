@@ -43,99 +43,222 @@ var (
 // FeatureContext defines godog.Suite steps for the test suite.
 func FeatureContext(s *godog.Suite) {
 	// Executing commands
-	s.Step(`^executing "(.*)"$`,
+	Step(s, `^executing "(.*)" with timeout "(\d*(?:ms|s|m|h))"$`,
+		ExecuteCommandWithTimeout)
+	Step(s, `^executing "(.*)" times out after "(\d*(?:ms|s|m|h))"$`,
+		ExecuteCommandTimesOut)
+	Step(s, `^executing "(.*)" with stdin from file "([^"]*)"$`,
+		ExecuteCommandWithStdinFromFile)
+	Step(s, `^executing "(.*)" exits with "([^"]*)"$`,
+		ExecuteCommandExitsWithCode)
+	Step(s, `^executing "(.*)"$`,
 		ExecuteCommand)
-	s.Step(`^executing "(.*)" (succeeds|fails)$`,
+	Step(s, `^executing "(.*)" exits with code (\d+)$`,
+		ExecuteCommandExitsWithCode)
+	Step(s, `^executing "(.*)" in a terminal$`,
+		ExecuteCommandInTerminal)
+	Step(s, `^executing "(.*)" with stdin:$`,
+		ExecuteCommandWithStdin)
+	Step(s, `^executing "(.*)" with the previous stdout as stdin$`,
+		ExecuteCommandWithPreviousStdout)
+	Step(s, `^on cleanup executing "(.*)"$`,
+		ExecuteCommandOnCleanup)
+	Step(s, `^processes left behind are killed$`,
+		KillLeftoverProcesses)
+	Step(s, `^no processes should be left behind$`,
+		NoProcessesShouldBeLeft)
+	Step(s, `^`+scenarioSetUpStep+`$`,
+		ScenarioIsSetUp)
+	Step(s, `^the shell is restarted$`,
+		RestartHostShellInstance)
+	Step(s, `^executing script:$`,
+		ExecuteScript)
+	Step(s, `^executing script succeeds:$`,
+		ExecuteScriptSucceeds)
+
+	// Environment variables
+	Step(s, `^setting environment variable "([^"]*)" to "(.*)"$`,
+		SetEnvironmentVariable)
+	Step(s, `^unsetting environment variable "([^"]*)"$`,
+		UnsetEnvironmentVariable)
+	Step(s, `^environment variable "([^"]*)" should equal "(.*)"$`,
+		EnvironmentVariableShouldEqual)
+
+	// Interactive commands
+	Step(s, `^executing "(.*)" interactively$`,
+		ExecuteCommandInteractively)
+	Step(s, `^when stdout shows "([^"]*)" send secret "(.*)"$`,
+		SendSecretOnOutput)
+	Step(s, `^when stdout shows "([^"]*)" send "(.*)"$`,
+		SendInputOnOutput)
+	Step(s, `^the interactive command exits with code (\d+)$`,
+		InteractiveCommandExitsWithCode)
+
+	// Background processes
+	Step(s, `^starting "(.*)" in background as "([^"]*)"$`,
+		StartBackgroundProcess)
+	Step(s, `^background "([^"]*)" (stdout|stderr) should contain "(.*)" within "(\d*(?:ms|s|m|h))"$`,
+		BackgroundProcessOutputShouldContainWithin)
+	Step(s, `^sending signal "(SIG[A-Z0-9]+)" to "([^"]*)"$`,
+		SendSignalToBackgroundProcess)
+	Step(s, `^background "([^"]*)" exits with code (\d+)$`,
+		BackgroundProcessExitsWithCode)
+
+	// Commands run without the shell
+	Step(s, `^running "([^"]*)"$`,
+		RunCommand)
+	Step(s, `^running "([^"]*)" with arguments:$`,
+		RunCommandWithArguments)
+
+	// Named shell sessions
+	Step(s, `^in shell "([^"]*)" executing "(.*)"$`,
+		ExecuteCommandInShell)
+	Step(s, `^in shell "([^"]*)" executing "(.*)" (succeeds|fails)$`,
+		ExecuteCommandInShellSucceedsOrFails)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should contain|contains) "(.*)"$`,
+		ShellReturnShouldContain)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should|does) not contain "(.*)"$`,
+		ShellReturnShouldNotContain)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should equal|equals) "(.*)"$`,
+		ShellReturnShouldEqual)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should|does) not equal "(.*)"$`,
+		ShellReturnShouldNotEqual)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should match|matches) "(.*)"$`,
+		ShellReturnShouldMatch)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should|does) not match "(.*)"$`,
+		ShellReturnShouldNotMatch)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should be|is) empty$`,
+		ShellReturnShouldBeEmpty)
+	Step(s, `^(stdout|stderr|exitcode) of shell "([^"]*)" (?:should not be|is not) empty$`,
+		ShellReturnShouldNotBeEmpty)
+
+	Step(s, `^executing "(.*)" (succeeds|fails)$`,
 		ExecuteCommandSucceedsOrFails)
 
 	// Command output verification
-	s.Step(`^(stdout|stderr|exitcode) (?:should contain|contains) "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should contain|contains) "(.*)"$`,
 		CommandReturnShouldContain)
-	s.Step(`^(stdout|stderr|exitcode) (?:should contain|contains)$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should contain|contains)$`,
 		CommandReturnShouldContainContent)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does) not contain "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does) not contain "(.*)"$`,
 		CommandReturnShouldNotContain)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does not) contain$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does not) contain$`,
 		CommandReturnShouldNotContainContent)
 
-	s.Step(`^(stdout|stderr|exitcode) (?:should equal|equals) "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should equal|equals) "(.*)"$`,
 		CommandReturnShouldEqual)
-	s.Step(`^(stdout|stderr|exitcode) (?:should equal|equals)$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should equal|equals)$`,
 		CommandReturnShouldEqualContent)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does) not equal "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does) not equal "(.*)"$`,
 		CommandReturnShouldNotEqual)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does) not equal$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does) not equal$`,
 		CommandReturnShouldNotEqualContent)
 
-	s.Step(`^(stdout|stderr|exitcode) (?:should match|matches) "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should match|matches) "(.*)"$`,
 		CommandReturnShouldMatch)
-	s.Step(`^(stdout|stderr|exitcode) (?:should match|matches)`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should match|matches)`,
 		CommandReturnShouldMatchContent)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does) not match "(.*)"$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does) not match "(.*)"$`,
 		CommandReturnShouldNotMatch)
-	s.Step(`^(stdout|stderr|exitcode) (?:should|does) not match`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should|does) not match`,
 		CommandReturnShouldNotMatchContent)
 
-	s.Step(`^(stdout|stderr|exitcode) (?:should be|is) empty$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should be|is) empty$`,
 		CommandReturnShouldBeEmpty)
-	s.Step(`^(stdout|stderr|exitcode) (?:should not be|is not) empty$`,
+	Step(s, `^(stdout|stderr|exitcode) (?:should not be|is not) empty$`,
 		CommandReturnShouldNotBeEmpty)
 
-	s.Step(`^(stdout|stderr|exitcode) (?:should be|is) valid "([^"]*)"$`,
+	Step(s, `^the last command should take (less|more) than "(\d*(?:ms|s|m|h))"$`,
+		LastCommandShouldTake)
+	Step(s, `^benchmarking "(.*)" (\d+) times$`,
+		BenchmarkCommand)
+	Step(s, `^benchmarking "(.*)" (\d+) times against baseline "([^"]*)"$`,
+		BenchmarkCommandAgainstBaseline)
+	Step(s, `^benchmarking "(.*)" (\d+) times updating baseline "([^"]*)"$`,
+		BenchmarkCommandUpdatingBaseline)
+	Step(s, `^peak memory of the last command should be below "([^"]*)"$`,
+		PeakMemoryShouldBeBelow)
+	Step(s, `^CPU time of the last command should be below "(\d*(?:ms|s|m|h))"$`,
+		CPUTimeShouldBeBelow)
+	Step(s, `^exitcode should be one of "([^"]*)"$`,
+		ExitCodeShouldBeOneOf)
+	Step(s, `^exitcode should be (greater|less) than (\d+)$`,
+		ExitCodeShouldCompare)
+	Step(s, `^(stdout|stderr|exitcode) (?:should be|is) valid "([^"]*)"$`,
 		ShouldBeInValidFormat)
 
 	// Command output and execution: extra steps
-	s.Step(`^with up to "(\d*)" retries with wait period of "(\d*(?:ms|s|m))" command "(.*)" output (should contain|contains|should not contain|does not contain) "(.*)"$`,
+	Step(s, `^with up to "(\d*)" retries with wait period of "(\d*(?:ms|s|m))" command "(.*)" output (should contain|contains|should not contain|does not contain) "(.*)"$`,
 		ExecuteCommandWithRetry)
-	s.Step(`^evaluating stdout of the previous command succeeds$`,
+	Step(s, `^within "(\d*(?:ms|s|m|h))" polling every "(\d*(?:ms|s|m|h))"(?: with backoff "(\d+(?:\.\d+)?)")?:$`,
+		RetrySteps)
+	Step(s, `^eventually executing "(.*)" until (stdout|stderr|exitcode) (?:matches|should match) "(.*)"$`,
+		ExecuteCommandUntil)
+	Step(s, `^within "(\d*(?:ms|s|m|h))" polling every "(\d*(?:ms|s|m|h))"(?: with backoff "(\d+(?:\.\d+)?)")? executing "(.*)" until (stdout|stderr|exitcode) (?:matches|should match) "(.*)"$`,
+		ExecuteCommandUntilWithin)
+	Step(s, `^for "(\d*(?:ms|s|m|h))" polling every "(\d*(?:ms|s|m|h))":$`,
+		StepsHoldFor)
+	Step(s, `^for "(\d*(?:ms|s|m|h))" polling every "(\d*(?:ms|s|m|h))" command "(.*)" (stdout|stderr|exitcode) (should contain|contains|should not contain|does not contain|should equal|equals|should not equal|does not equal|should match|matches|should not match|does not match) "(.*)"$`,
+		CommandOutputHoldsFor)
+	Step(s, `^the following steps fail with "(.*)":$`,
+		StepsFailWith)
+	Step(s, `^the following steps fail with error matching "(.*)":$`,
+		StepsFailWithErrorMatching)
+	Step(s, `^soft assertions:$`,
+		SoftAssertions)
+	Step(s, `^evaluating stdout of the previous command succeeds$`,
 		ExecuteStdoutLineByLine)
 
 	// Scenario variables
 	// allows to set a scenario variable to the output values of minishift and oc commands
 	// and then refer to it by $(NAME_OF_VARIABLE) directly in the text of feature file
-	s.Step(`^setting scenario variable "(.*)" to the stdout from executing "(.*)"$`,
+	Step(s, `^setting scenario variable "(.*)" to the duration of the last command$`,
+		SetScenarioVariableToLastCmdDuration)
+	Step(s, `^setting scenario variable "(.*)" to the stdout from executing "(.*)"$`,
 		SetScenarioVariableExecutingCommand)
 
 	// Filesystem operations
-	s.Step(`^creating directory "([^"]*)" succeeds$`,
+	Step(s, `^creating directory "([^"]*)" succeeds$`,
 		CreateDirectory)
-	s.Step(`^creating file "([^"]*)" succeeds$`,
+	Step(s, `^creating file "([^"]*)" succeeds$`,
 		CreateFile)
-	s.Step(`^deleting directory "([^"]*)" succeeds$`,
+	Step(s, `^deleting directory "([^"]*)" succeeds$`,
 		DeleteDirectory)
-	s.Step(`^deleting file "([^"]*)" succeeds$`,
+	Step(s, `^deleting file "([^"]*)" succeeds$`,
 		DeleteFile)
-	s.Step(`^directory "([^"]*)" should not exist$`,
+	Step(s, `^directory "([^"]*)" should not exist$`,
 		DirectoryShouldNotExist)
-	s.Step(`^file "([^"]*)" should not exist$`,
+	Step(s, `^file "([^"]*)" should not exist$`,
 		FileShouldNotExist)
-	s.Step(`^file "([^"]*)" exists$`,
+	Step(s, `^file "([^"]*)" exists$`,
 		FileExist)
-	s.Step(`^file from "(.*)" is downloaded into location "(.*)"$`,
+	Step(s, `^archiving the test run directory as "([^"]*)"$`,
+		ArchiveTestRunDir)
+	Step(s, `^file from "(.*)" is downloaded into location "(.*)"$`,
 		DownloadFileIntoLocation)
-	s.Step(`^writing text "([^"]*)" to file "([^"]*)" succeeds$`,
+	Step(s, `^writing text "([^"]*)" to file "([^"]*)" succeeds$`,
 		WriteToFile)
 
 	// File content checks
-	s.Step(`^content of file "([^"]*)" should contain "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should contain "([^"]*)"$`,
 		FileContentShouldContain)
-	s.Step(`^content of file "([^"]*)" should not contain "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should not contain "([^"]*)"$`,
 		FileContentShouldNotContain)
-	s.Step(`^content of file "([^"]*)" should equal "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should equal "([^"]*)"$`,
 		FileContentShouldEqual)
-	s.Step(`^content of file "([^"]*)" should not equal "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should not equal "([^"]*)"$`,
 		FileContentShouldNotEqual)
-	s.Step(`^content of file "([^"]*)" should match "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should match "([^"]*)"$`,
 		FileContentShouldMatchRegex)
-	s.Step(`^content of file "([^"]*)" should not match "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" should not match "([^"]*)"$`,
 		FileContentShouldNotMatchRegex)
-	s.Step(`^content of file "([^"]*)" (?:should be|is) valid "([^"]*)"$`,
+	Step(s, `^content of file "([^"]*)" (?:should be|is) valid "([^"]*)"$`,
 		FileContentIsInValidFormat)
 
 	// Config file content, JSON and YAML
-	s.Step(`"(JSON|YAML)" config file "(.*)" (contains|does not contain) key "(.*)" with value matching "(.*)"$`,
+	Step(s, `"(JSON|YAML)" config file "(.*)" (contains|does not contain) key "(.*)" with value matching "(.*)"$`,
 		ConfigFileContainsKeyMatchingValue)
-	s.Step(`"(JSON|YAML)" config file "(.*)" (contains|does not contain) key "(.*)"$`,
+	Step(s, `"(JSON|YAML)" config file "(.*)" (contains|does not contain) key "(.*)"$`,
 		ConfigFileContainsKey)
 
 	s.BeforeSuite(func() {
@@ -147,6 +270,10 @@ func FeatureContext(s *godog.Suite) {
 	})
 
 	s.BeforeFeature(func(this *messages.GherkinDocument) {
+		nameFeatureWithShellPass(this)
+		if this.Feature != nil {
+			currentFeature = this.Feature.Name
+		}
 		util.LogMessage("info", fmt.Sprintf("----- Feature: %s -----", this.String()))
 		StartHostShellInstance(testWithShell)
 		util.ClearScenarioVariables()
@@ -158,19 +285,44 @@ func FeatureContext(s *godog.Suite) {
 	})
 
 	s.BeforeScenario(func(this *messages.Pickle) {
+		this.Name = withShellPass(this.Name)
+		currentScenario = this.Name
+		recordScenarioPeakUsage = hasTag(this, resourceUsageTag)
 		util.LogMessage("info", fmt.Sprintf("----- Scenario: %s -----", this.Name))
 		util.LogMessage("info", fmt.Sprintf("----- Scenario Outline: %s -----", this.String()))
+		err := RestartExitedShellInstances()
+		if err != nil {
+			fmt.Println(err)
+		}
+		scenarioSetupError = isolateScenario(this)
+		if scenarioSetupError != nil {
+			fmt.Println(scenarioSetupError)
+			util.LogMessage("info", scenarioSetupError.Error())
+		}
 	})
 
 	s.BeforeStep(func(this *messages.Pickle_PickleStep) {
 		this.Text = util.ProcessScenarioVariables(this.Text)
+		failStepOnSetupError(this)
 	})
 
-	s.AfterScenario(func(*messages.Pickle, error) {
+	s.AfterScenario(func(this *messages.Pickle, err error) {
+		if err != nil {
+			_, archiveErr := archiveTestRunDir(this.Name)
+			if archiveErr != nil {
+				fmt.Println(archiveErr)
+			}
+		}
+		StopInteractiveCommand()
+		RunCleanups()
+		StopBackgroundProcesses()
+		checkLeftoverProcesses(this.Name)
+		RestoreEnvironment()
 	})
 
 	s.AfterFeature(func(*messages.GherkinDocument) {
 		util.LogMessage("info", "----- Cleaning after feature -----")
+		CloseShellSessions()
 		CloseHostShellInstance()
 	})
 
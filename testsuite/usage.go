@@ -0,0 +1,225 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/code-ready/clicumber/util"
+)
+
+const (
+	resourceUsageReport = "resource-usage.jsonl"
+	resourceUsageTag    = "@resource-usage"
+)
+
+var (
+	// currentScenario is the name of the running scenario, used in the
+	// resource usage report
+	currentScenario string
+
+	// recordPeakUsage records the peak memory and context switches of the
+	// commands of all scenarios, recordScenarioPeakUsage those of the
+	// current scenario
+	recordPeakUsage         bool
+	recordScenarioPeakUsage bool
+)
+
+// resourceUsage is the resources used by the processes of a command.
+type resourceUsage struct {
+	UserTime                   time.Duration `json:"userTime"`
+	SystemTime                 time.Duration `json:"systemTime"`
+	MaxRSS                     int64         `json:"maxRSS,omitempty"`
+	VoluntaryContextSwitches   int64         `json:"voluntaryContextSwitches,omitempty"`
+	InvoluntaryContextSwitches int64         `json:"involuntaryContextSwitches,omitempty"`
+}
+
+// recordingPeakUsage returns whether the peak memory and context switches
+// of commands are recorded, for which commands executed in the shell run
+// in a subshell.
+func recordingPeakUsage() bool {
+	return peakUsageSupported && (recordPeakUsage || recordScenarioPeakUsage)
+}
+
+// newUsageReport creates the file a usage helper writes the resources used
+// by a command to.
+func newUsageReport() (string, error) {
+	file, err := ioutil.TempFile("", "clicumber-usage-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating file for resource usage: %v", err)
+	}
+
+	return file.Name(), file.Close()
+}
+
+// addReport adds the peak memory and context switches written to report
+// by a usage helper to usage. They stay unknown if the helper did not
+// write them, e.g. because the command exited the subshell.
+func (usage *resourceUsage) addReport(report string) {
+	data, err := ioutil.ReadFile(report)
+	if err != nil || len(data) == 0 {
+		return
+	}
+
+	var reported resourceUsage
+	err = json.Unmarshal(data, &reported)
+	if err != nil {
+		util.LogMessage("info", fmt.Sprintf("error reading resource usage: %v", err))
+		return
+	}
+
+	usage.MaxRSS = reported.MaxRSS
+	usage.VoluntaryContextSwitches = reported.VoluntaryContextSwitches
+	usage.InvoluntaryContextSwitches = reported.InvoluntaryContextSwitches
+}
+
+func (usage *resourceUsage) String() string {
+	if usage.MaxRSS == 0 {
+		return fmt.Sprintf("user %v, system %v", usage.UserTime, usage.SystemTime)
+	}
+
+	return fmt.Sprintf("user %v, system %v, max RSS %d bytes, context switches %d voluntary, %d involuntary",
+		usage.UserTime, usage.SystemTime, usage.MaxRSS, usage.VoluntaryContextSwitches, usage.InvoluntaryContextSwitches)
+}
+
+// GetLastCmdUsage returns the resources used by the last command, or nil
+// if they are not known on this OS.
+func (shell *ShellInstance) GetLastCmdUsage() *resourceUsage {
+	return shell.lastUsage
+}
+
+// recordUsage logs the resources used by command and appends them to the
+// resource usage report in the test results directory.
+func (shell *ShellInstance) recordUsage(command string, usage *resourceUsage) {
+	shell.lastUsage = usage
+	if usage == nil {
+		return
+	}
+
+	util.LogMessage("info", fmt.Sprintf("resource usage: %s", usage))
+	if testResultsDir == "" {
+		return
+	}
+
+	entry, err := json.Marshal(struct {
+		Scenario string        `json:"scenario"`
+		Command  string        `json:"command"`
+		Duration time.Duration `json:"duration"`
+		*resourceUsage
+	}{currentScenario, command, shell.lastDuration, usage})
+	if err != nil {
+		util.LogMessage("info", fmt.Sprintf("error encoding resource usage: %v", err))
+		return
+	}
+
+	report, err := os.OpenFile(filepath.Join(testResultsDir, resourceUsageReport), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		util.LogMessage("info", fmt.Sprintf("error opening resource usage report: %v", err))
+		return
+	}
+	defer report.Close()
+
+	report.Write(append(entry, '\n'))
+}
+
+func lastUsage() (*resourceUsage, error) {
+	usage := shell.GetLastCmdUsage()
+	if usage == nil {
+		return nil, fmt.Errorf("resource usage of commands is not available on %s", runtime.GOOS)
+	}
+
+	return usage, nil
+}
+
+func PeakMemoryShouldBeBelow(limit string) error {
+	usage, err := lastUsage()
+	if err != nil {
+		return err
+	}
+	bytes, err := parseSize(limit)
+	if err != nil {
+		return err
+	}
+	if usage.MaxRSS == 0 {
+		return fmt.Errorf("peak memory of the last command is not known, tag the scenario with %s or run with -test-resource-usage", resourceUsageTag)
+	}
+
+	if usage.MaxRSS >= bytes {
+		return fmt.Errorf("peak memory of the last command was %d bytes, expected below %s", usage.MaxRSS, limit)
+	}
+
+	return nil
+}
+
+func CPUTimeShouldBeBelow(limit string) error {
+	usage, err := lastUsage()
+	if err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(limit)
+	if err != nil {
+		return err
+	}
+
+	cpuTime := usage.UserTime + usage.SystemTime
+	if cpuTime >= duration {
+		return fmt.Errorf("CPU time of the last command was %v, expected below %v", cpuTime, duration)
+	}
+
+	return nil
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"KIB": 1024,
+	"MIB": 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+}
+
+var sizeRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z]*)$`)
+
+// parseSize parses a size like "200MB" or "1.5GiB" into bytes.
+func parseSize(size string) (int64, error) {
+	match := sizeRegex.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size: '%s'", size)
+	}
+
+	unit, ok := sizeUnits[strings.ToUpper(match[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid unit of size: '%s'", size)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: '%s'", size)
+	}
+
+	return int64(value * unit), nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc
+const clockTicks = 100
+
+// peakUsageSupported is set if the peak memory and context switches of
+// commands can be recorded with the usage helpers.
+const peakUsageSupported = true
+
+// usageMonitor collects the CPU time used by the commands the shell with
+// the given pid runs, from the times of the waited for children of the
+// shell.
+type usageMonitor struct {
+	pid       int
+	startUser time.Duration
+	startSys  time.Duration
+	stopOnce  sync.Once
+	usage     *resourceUsage
+}
+
+// startUsageMonitor starts collecting the CPU time used by the children of
+// the process with the given pid.
+func startUsageMonitor(pid int) *usageMonitor {
+	user, sys, err := childrenTimes(pid)
+	if err != nil {
+		return nil
+	}
+
+	return &usageMonitor{pid: pid, startUser: user, startSys: sys}
+}
+
+// Stop returns the CPU time used since the monitor was started.
+func (monitor *usageMonitor) Stop() *resourceUsage {
+	if monitor == nil {
+		return nil
+	}
+
+	monitor.stopOnce.Do(func() {
+		user, sys, err := childrenTimes(monitor.pid)
+		if err != nil {
+			return
+		}
+
+		monitor.usage = &resourceUsage{UserTime: user - monitor.startUser, SystemTime: sys - monitor.startSys}
+	})
+
+	return monitor.usage
+}
+
+// processUsage returns the resources used by a process run directly. The
+// peak RSS and context switches are read from the report of the run-usage
+// helper, if the process was run by it, as the peak RSS in the rusage of
+// a process includes the memory of the process it was forked from.
+func processUsage(state *os.ProcessState, report string) *resourceUsage {
+	usage := &resourceUsage{UserTime: state.UserTime(), SystemTime: state.SystemTime()}
+	if report != "" {
+		usage.addReport(report)
+	}
+
+	return usage
+}
+
+// exitWithUsage writes the resources used by the waited for children of
+// the process to the report given as first argument and exits with the
+// exit code given as second argument. It runs in the subshell of a command
+// which executes it when the command finished, which keeps the resources
+// used by the command.
+func exitWithUsage(args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected the report and the exit code as arguments")
+	}
+	exitCode, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid exit code '%s'", args[1])
+	}
+
+	err = writeUsageReport(args[0])
+	if err != nil {
+		return err
+	}
+	os.Exit(exitCode)
+
+	return nil
+}
+
+// runWithUsage runs the program given by the arguments after the report,
+// writes the resources it used to the report and exits with its exit code.
+func runWithUsage(args []string) error {
+	if len(args) < 2 {
+		return errors.New("expected the report and the program as arguments")
+	}
+
+	cmd := exec.Command(args[1], args[2:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Start()
+	// a missing program is reported like the shells do
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "%s: command not found\n", args[1])
+		os.Exit(127)
+	}
+	if err != nil {
+		return err
+	}
+	cmd.Wait()
+
+	err = writeUsageReport(args[0])
+	if err != nil {
+		return err
+	}
+	os.Exit(processExitCode(cmd.ProcessState))
+
+	return nil
+}
+
+// writeUsageReport writes the peak RSS and context switches of the waited
+// for children of the process, as the kernel accounted them, to report.
+func writeUsageReport(report string) error {
+	var rusage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &rusage)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(resourceUsage{
+		MaxRSS:                     rusage.Maxrss * 1024,
+		VoluntaryContextSwitches:   rusage.Nvcsw,
+		InvoluntaryContextSwitches: rusage.Nivcsw,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(report, data, 0644)
+}
+
+// childrenTimes returns the user and system CPU time of the waited for
+// children of the process.
+func childrenTimes(pid int) (time.Duration, time.Duration, error) {
+	fields, err := statFields(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) < 15 {
+		return 0, 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	// cutime and cstime are the 16th and 17th field of the whole line
+	user, err := strconv.ParseInt(fields[13], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	sys, err := strconv.ParseInt(fields[14], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return time.Duration(user) * time.Second / clockTicks, time.Duration(sys) * time.Second / clockTicks, nil
+}
@@ -0,0 +1,52 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright (C) 2019 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// peakUsageSupported is not set, resource usage is not collected.
+const peakUsageSupported = false
+
+// usageMonitor is not implemented, resource usage is not collected.
+type usageMonitor struct{}
+
+func startUsageMonitor(pid int) *usageMonitor {
+	return nil
+}
+
+func (monitor *usageMonitor) Stop() *resourceUsage {
+	return nil
+}
+
+func processUsage(state *os.ProcessState, report string) *resourceUsage {
+	return nil
+}
+
+func exitWithUsage(args []string) error {
+	return fmt.Errorf("resource usage of commands is not available on %s", runtime.GOOS)
+}
+
+func runWithUsage(args []string) error {
+	return fmt.Errorf("resource usage of commands is not available on %s", runtime.GOOS)
+}
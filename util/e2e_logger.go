@@ -29,6 +29,7 @@ import (
 const (
 	messageInfoMaxLength = 7
 	timeHeaderLength     = 16
+	outputPreviewLength  = 1024
 )
 
 var (
@@ -72,6 +73,27 @@ func LogMessage(messageInfo, message string) error {
 	return nil
 }
 
+// LogOutput logs a line of command output. Lines longer than
+// outputPreviewLength are truncated and bytes which are not valid UTF-8
+// are replaced, so that the log stays readable.
+func LogOutput(messageInfo, output string) error {
+	return LogMessage(messageInfo, previewOutput(output))
+}
+
+func previewOutput(output string) string {
+	preview := output
+	if len(preview) > outputPreviewLength {
+		preview = preview[:outputPreviewLength]
+	}
+	preview = strings.ToValidUTF8(preview, "\uFFFD")
+
+	if len(output) > outputPreviewLength {
+		preview += fmt.Sprintf("... (%d bytes truncated)", len(output)-outputPreviewLength)
+	}
+
+	return preview
+}
+
 func formatMessage(message string) string {
 	formattedMessage := ": "
 	offsetLength := timeHeaderLength + messageInfoMaxLength + len(formattedMessage)